@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"text/template"
+
+	"github.com/Atnuhs/go-bundler/bundler"
+	"golang.org/x/tools/go/packages"
+)
+
+// batchTarget is the data of the -o and -report templates when bundling
+// several packages.
+type batchTarget struct {
+	Dir  string // package directory relative to -dir, e.g. abc123/a
+	Name string // last element of Dir, e.g. a
+	Path string // import path
+}
+
+type batchResult struct {
+	target batchTarget
+	dst    destination
+	report *bundler.Report
+	err    error
+	diff   bytes.Buffer
+}
+
+// runBatch bundles every main package (every package with -lib) matching
+// the patterns. The packages are loaded at once and bundled concurrently by
+// up to jobs workers; each bundle is written to the path given by the -o
+// template. A summary table is written to w.
+func runBatch(opts bundler.Options, patterns []string, jobs int, w io.Writer) error {
+	outTmpl, err := template.New("o").Parse(*outPath)
+	if err != nil {
+		return fmt.Errorf("-o: %w", err)
+	}
+	var reportTmpl *template.Template
+	if *reportPath != "" {
+		if reportTmpl, err = template.New("report").Parse(*reportPath); err != nil {
+			return fmt.Errorf("-report: %w", err)
+		}
+	}
+
+	opts.Patterns = patterns
+	pkgs, err := bundler.Load(opts)
+	if err != nil {
+		return fmt.Errorf("load packages: %w", err)
+	}
+
+	targets := batchTargets(pkgs, opts.Library)
+	if len(targets) == 0 {
+		return fmt.Errorf("no main package matches %s", strings.Join(patterns, " "))
+	}
+
+	results := make([]*batchResult, len(targets))
+	used := make(map[string]string) // output path -> package
+	for i, pkg := range targets {
+		r := &batchResult{target: newBatchTarget(opts.Dir, pkg)}
+		if r.dst.path, err = execTemplate(outTmpl, r.target); err != nil {
+			return fmt.Errorf("-o: %w", err)
+		}
+		if reportTmpl != nil {
+			if r.dst.report, err = execTemplate(reportTmpl, r.target); err != nil {
+				return fmt.Errorf("-report: %w", err)
+			}
+		}
+		if prev, ok := used[r.dst.path]; ok {
+			return fmt.Errorf("%s and %s are both written to %s; use a template such as -o 'bundled/{{.Dir}}.go'", prev, pkg.PkgPath, r.dst.path)
+		}
+		used[r.dst.path] = pkg.PkgPath
+		if !*check {
+			if err := os.MkdirAll(filepath.Dir(r.dst.path), 0755); err != nil {
+				return err
+			}
+		}
+		r.dst.diff = &r.diff
+		results[i] = r
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, max(jobs, 1))
+	for i, pkg := range targets {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(r *batchResult, pkg *packages.Package) {
+			defer func() { <-sem; wg.Done() }()
+			res, err := bundler.Bundle([]*packages.Package{pkg}, opts)
+			r.report, r.err = reportOf(res), writeBundle(res, err, r.dst)
+		}(results[i], pkg)
+	}
+	wg.Wait()
+
+	for _, r := range results {
+		w.Write(r.diff.Bytes())
+	}
+	return writeBatchSummary(w, results)
+}
+
+// batchTargets returns the packages to bundle, sorted by import path.
+func batchTargets(pkgs []*packages.Package, library bool) []*packages.Package {
+	var targets []*packages.Package
+	for _, pkg := range pkgs {
+		if len(pkg.CompiledGoFiles) == 0 {
+			continue
+		}
+		if library || pkg.Name == "main" {
+			targets = append(targets, pkg)
+		}
+	}
+	slices.SortFunc(targets, func(a, b *packages.Package) int { return cmp.Compare(a.PkgPath, b.PkgPath) })
+	return targets
+}
+
+func newBatchTarget(dir string, pkg *packages.Package) batchTarget {
+	t := batchTarget{Path: pkg.PkgPath}
+	pkgDir := filepath.Dir(pkg.CompiledGoFiles[0])
+	t.Dir = pkgDir
+	if filepath.IsAbs(pkgDir) {
+		dir, _ = filepath.Abs(dir)
+	}
+	// packages loaded from an FS have file names relative to its root, as dir
+	if rel, err := filepath.Rel(dir, pkgDir); err == nil {
+		t.Dir = rel
+	}
+	t.Dir = filepath.ToSlash(t.Dir)
+	t.Name = filepath.Base(pkgDir)
+	return t
+}
+
+func execTemplate(t *template.Template, data any) (string, error) {
+	var buf strings.Builder
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// writeBatchSummary writes a table of the results and returns an error when
+// any package failed.
+func writeBatchSummary(w io.Writer, results []*batchResult) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "PACKAGE\tSTATUS\tBYTES\tOUTPUT")
+	failed := 0
+	for _, r := range results {
+		if r.err != nil {
+			failed++
+			msg, _, _ := strings.Cut(r.err.Error(), "\n")
+			fmt.Fprintf(tw, "%s\tFAIL\t-\t%s\n", r.target.Dir, msg)
+			continue
+		}
+		fmt.Fprintf(tw, "%s\tok\t%d\t%s\n", r.target.Dir, r.report.BundledBytes, r.dst.path)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d packages failed", failed, len(results))
+	}
+	return nil
+}
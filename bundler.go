@@ -1,476 +0,0 @@
-package main
-
-import (
-	"errors"
-	"fmt"
-	"go/ast"
-	"go/format"
-	"go/token"
-	"go/types"
-	"io"
-	"path/filepath"
-	"slices"
-
-	"golang.org/x/tools/go/ast/astutil"
-	"golang.org/x/tools/go/packages"
-)
-
-type (
-	pkgPath   string
-	pkgPrefix string
-)
-
-type Bundler struct {
-	// input
-	pkgs []*packages.Package
-
-	// cache
-	mainPkg   *packages.Package
-	topoPkgs  []*packages.Package
-	prefixes  map[pkgPath]pkgPrefix
-	pkgPaths  map[string]pkgPath
-	pkgByPath map[pkgPath]*packages.Package
-	replaced  map[ast.Node]string
-
-	// output
-	bundled    *ast.File
-	totalLines int
-}
-
-func Bundle(pkgs []*packages.Package, w io.Writer) (int, error) {
-	// init
-	b := &Bundler{pkgs: pkgs}
-	if err := b.Init(); err != nil {
-		return 0, err
-	}
-
-	// bundle
-	file, err := b.buildDeclFile()
-	if err != nil {
-		return 0, err
-	}
-	b.applyPrefixes(file)
-
-	// format
-	if err := format.Node(w, b.pkgs[0].Fset, b.bundled); err != nil {
-		return 0, err
-	}
-	return b.totalLines, nil
-}
-
-func (b *Bundler) Init() error {
-	if err := b.searchMainPkg(); err != nil {
-		return err
-	}
-	b.topologicalSortPkgs()
-	b.countTotalLine()
-	b.generatePrefixes()
-	b.initPkgMaps()
-	return nil
-}
-
-func (b *Bundler) searchMainPkg() error {
-	// mainパッケージが複数あることは考慮しない
-	for _, p := range b.pkgs {
-		if p.Name == "main" {
-			b.mainPkg = p
-			return nil
-		}
-	}
-	return errors.New("main package not found")
-}
-
-func (b *Bundler) topologicalSortPkgs() {
-	visited := make(map[pkgPath]bool)
-	b.topoPkgs = make([]*packages.Package, 0, 128)
-
-	var dfs func(p *packages.Package)
-	dfs = func(p *packages.Package) {
-
-		// ignore visited package
-		pp := pkgPath(p.PkgPath)
-		if visited[pp] || isStd(pp) {
-			return
-		}
-		visited[pp] = true
-		for _, q := range p.Imports {
-			dfs(q)
-		}
-		b.topoPkgs = append(b.topoPkgs, p)
-	}
-	dfs(b.mainPkg)
-
-	slices.Reverse(b.topoPkgs)
-}
-
-func (b *Bundler) countTotalLine() {
-	b.totalLines = 0
-	for _, p := range b.topoPkgs {
-		b.totalLines += totalLineInPackage(p)
-	}
-}
-
-func (b *Bundler) generatePrefixes() {
-	pkgPathsByPkgName := make(map[string][]pkgPath)
-	for _, now := range b.topoPkgs {
-		name, path := now.Name, pkgPath(now.PkgPath)
-		pkgPathsByPkgName[name] = append(pkgPathsByPkgName[name], path)
-	}
-
-	// constrcut data
-	b.prefixes = make(map[pkgPath]pkgPrefix, len(b.topoPkgs))
-	for name, paths := range pkgPathsByPkgName {
-		slices.Sort(paths)
-		if len(paths) == 1 {
-			b.prefixes[paths[0]] = pkgPrefix(name)
-			continue
-		}
-		for i, path := range paths {
-			prefix := pkgPrefix(fmt.Sprintf("%s_%02d", name, i))
-			b.prefixes[path] = prefix
-		}
-	}
-}
-
-func (b *Bundler) initPkgMaps() {
-	b.pkgPaths = make(map[string]pkgPath)
-	b.pkgByPath = make(map[pkgPath]*packages.Package)
-
-	for _, pkg := range b.topoPkgs {
-		for _, f := range pkg.Syntax {
-			pos := pkg.Fset.Position(f.Pos())
-			pp := pkgPath(pkg.PkgPath)
-			fp := filepath.ToSlash(pos.Filename)
-			b.pkgPaths[fp] = pp
-			b.pkgByPath[pp] = pkg
-		}
-	}
-}
-
-func (b *Bundler) buildDeclFile() (*ast.File, error) {
-	reachable := AnalyzeReachableDecls(b.mainPkg, b.topoPkgs)
-	builder := NewBuilder(b.mainPkg.Fset, b.pkgPaths)
-
-	for _, pkg := range b.topoPkgs {
-		info := pkg.TypesInfo
-		for _, f := range pkg.Syntax {
-			ast.Inspect(f, func(n ast.Node) bool {
-				switch v := n.(type) {
-				case *ast.GenDecl:
-					switch v.Tok {
-					case token.IMPORT:
-						for _, spec := range v.Specs {
-							if importSpec, ok := spec.(*ast.ImportSpec); ok {
-								builder.addImportSpec(importSpec)
-							}
-						}
-						return false
-					case token.TYPE:
-						for _, spec := range v.Specs {
-							if typeSpec, ok := spec.(*ast.TypeSpec); ok {
-								if obj, ok := info.Defs[typeSpec.Name]; ok && reachable[obj] {
-									builder.addTypeSpec(typeSpec)
-								}
-							}
-						}
-					case token.VAR:
-						for _, spec := range v.Specs {
-							if varSpec, ok := spec.(*ast.ValueSpec); ok {
-								var used bool
-								for _, name := range varSpec.Names {
-									if obj, ok := info.Defs[name]; ok && isPkgLevel(obj) && reachable[obj] {
-										used = true
-									}
-								}
-								if used {
-									builder.addValueSpec(varSpec)
-								}
-							}
-						}
-					case token.CONST:
-						var used bool
-						for _, spec := range v.Specs {
-							if constSpec, ok := spec.(*ast.ValueSpec); ok {
-								for _, name := range constSpec.Names {
-									if obj, ok := info.Defs[name]; ok && isPkgLevel(obj) && reachable[obj] {
-										used = true
-									}
-								}
-							}
-						}
-						if used {
-							builder.addConstDecl(v)
-						}
-					}
-				case *ast.FuncDecl:
-					if obj, ok := info.Defs[v.Name]; ok && reachable[obj] {
-						if !isFuncNonMethod(obj) {
-							// method
-							builder.addFuncDecl(v)
-							break
-						}
-						// func
-						switch v.Name.Name {
-						case "init":
-							builder.addInitDecl(v)
-						case "main":
-							builder.setMainDecl(v)
-						default:
-							builder.addFuncDecl(v)
-						}
-					}
-				}
-				return true
-			})
-		}
-	}
-	file, err := builder.Build()
-	b.bundled = file
-	return file, err
-}
-
-func (b *Bundler) applyPrefixes(file *ast.File) {
-	b.replaced = make(map[ast.Node]string, 128)
-	astutil.Apply(file, func(c *astutil.Cursor) bool {
-		switch v := c.Node().(type) {
-		case *ast.SelectorExpr:
-			b.rewriteSelector(c, v)
-		case *ast.Ident:
-			b.rewriteIdent(v)
-		}
-		return true
-	}, nil)
-}
-
-func (b *Bundler) rewriteSelector(c *astutil.Cursor, n *ast.SelectorExpr) {
-	_, info, ok := b.infoOfNode(n)
-	if !ok {
-		return
-	}
-	if pp, ok := isPkgSelector(n, info); ok {
-		if prefixAdded, ok := b.addPrefix(pp, n.Sel); ok {
-			dst := ast.NewIdent(prefixAdded)
-			dst.NamePos = n.Sel.NamePos
-			c.Replace(dst)
-			b.replaced[n.Sel] = prefixAdded
-		}
-	} else if pp, ok := isEmbeddedSel(n, info); ok {
-		if prefixAdded, ok := b.addPrefix(pp, n.Sel); ok {
-			n.Sel.Name = prefixAdded
-			b.replaced[n.Sel] = prefixAdded
-		}
-	}
-}
-
-func (b *Bundler) rewriteIdent(n *ast.Ident) {
-	pkg, info, ok := b.infoOfNode(n)
-	if !ok {
-		return
-	}
-	if isPkgLevelIdent(pkg, info, n) {
-		if prefixAdded, ok := b.addPrefix(pkgPath(pkg.PkgPath), n); ok {
-			n.Name = prefixAdded
-			b.replaced[n] = prefixAdded
-		}
-		return
-	}
-
-	// dot-imported: ident is in pkg's file but defined in a different non-std package
-	if obj := info.Uses[n]; obj != nil {
-		if objPkg := obj.Pkg(); objPkg != nil && objPkg != pkg.Types && obj.Parent() == objPkg.Scope() {
-			pp := pkgPath(objPkg.Path())
-			if !isStd(pp) {
-				if prefixAdded, ok := b.addPrefix(pp, n); ok {
-					n.Name = prefixAdded
-					b.replaced[n] = prefixAdded
-				}
-				return
-			}
-		}
-	}
-
-	if pp, ok := isEmbeddedFieldKey(n, info); ok {
-		if prefixAdded, ok := b.addPrefix(pp, n); ok {
-			n.Name = prefixAdded
-			b.replaced[n] = prefixAdded
-		}
-		return
-	}
-}
-
-func (b *Bundler) addPrefix(pp pkgPath, src *ast.Ident) (string, bool) {
-	if cached, ok := b.replaced[src]; ok {
-		return cached, true
-	}
-	prefix, ok := b.prefixes[pp]
-	if !ok {
-		return "", false
-	}
-	return fmt.Sprintf("%s_%s", string(prefix), src.Name), true
-}
-
-func (b *Bundler) infoOfNode(n ast.Node) (*packages.Package, *types.Info, bool) {
-	if n == nil {
-		return nil, nil, false
-	}
-	pos := b.mainPkg.Fset.Position(n.Pos())
-	if !pos.IsValid() {
-		return nil, nil, false
-	}
-
-	path := filepath.ToSlash(pos.Filename)
-	if pp, ok := b.pkgPaths[path]; ok {
-		if pkg := b.pkgByPath[pp]; pkg != nil && pkg.TypesInfo != nil {
-			return pkg, pkg.TypesInfo, true
-		}
-	}
-	return nil, nil, false
-}
-
-func isPkgLevel(obj types.Object) bool {
-	pkg := obj.Pkg()
-	if pkg == nil {
-		return false
-	}
-	return obj.Parent() == pkg.Scope()
-}
-
-func isFuncNonMethod(obj types.Object) bool {
-	fn, ok := obj.(*types.Func)
-	if !ok {
-		return false
-	}
-	sig, ok := fn.Type().(*types.Signature)
-	if !ok {
-		return false
-	}
-	return sig.Recv() == nil
-}
-
-// isPkgSelector returns pkgPath if sel is pkg.Sel
-func isPkgSelector(sel *ast.SelectorExpr, info *types.Info) (pkgPath, bool) {
-	if info.Selections[sel] != nil {
-		// ignore structure field and method
-		return "", false
-	}
-
-	// X should be Ident
-	xid, ok := sel.X.(*ast.Ident)
-	if !ok {
-		return "", false
-	}
-
-	// X should be used at pkgName
-	pkgName, ok := info.Uses[xid].(*types.PkgName)
-	if !ok || pkgName == nil {
-		return "", false
-	}
-
-	p := pkgName.Imported()
-	if p == nil {
-		return "", false
-	}
-
-	//should be non std pkg
-	pp := pkgPath(p.Path())
-	if isStd(pp) {
-		return "", false
-	}
-	return pp, true
-}
-
-func namedTypeOf(t types.Type) *types.Named {
-	switch tt := t.(type) {
-	case *types.Named:
-		return tt
-	case *types.Pointer:
-		if n, ok := tt.Elem().(*types.Named); ok {
-			return n
-		}
-	}
-	return nil
-}
-
-func isEmbeddedSel(sel *ast.SelectorExpr, info *types.Info) (pkgPath, bool) {
-	s := info.Selections[sel]
-	if s == nil || s.Kind() != types.FieldVal {
-		return "", false
-	}
-
-	v, ok := s.Obj().(*types.Var)
-	if !ok || !v.Anonymous() {
-		return "", false
-	}
-
-	named := namedTypeOf(v.Type())
-	if named == nil {
-		return "", false
-	}
-
-	obj := named.Obj()
-	if obj == nil || obj.Pkg() == nil {
-		return "", false
-	}
-	pp := pkgPath(obj.Pkg().Path())
-	if isStd(pp) {
-		return "", false
-	}
-	return pp, true
-}
-
-func isPkgLevelIdent(pkg *packages.Package, info *types.Info, id *ast.Ident) bool {
-	if id == nil || id.Name == "_" {
-		return false
-	}
-
-	var obj types.Object
-	if o := info.Uses[id]; o != nil {
-		obj = o
-	} else if o := info.Defs[id]; o != nil {
-		obj = o
-	} else {
-		return false
-	}
-
-	if obj.Pkg() == nil {
-		return false
-	}
-	return obj.Pkg() == pkg.Types && obj.Parent() == pkg.Types.Scope()
-}
-
-func isEmbeddedFieldKey(id *ast.Ident, info *types.Info) (pkgPath, bool) {
-	obj, ok := info.Uses[id].(*types.Var)
-	if !ok || !obj.Anonymous() {
-		return "", false
-	}
-
-	named := namedTypeOf(obj.Type())
-	if named == nil {
-		return "", false
-	}
-
-	typeObj := named.Obj()
-	if typeObj == nil || typeObj.Pkg() == nil {
-		return "", false
-	}
-
-	pp := pkgPath(typeObj.Pkg().Path())
-	if isStd(pp) {
-		return "", false
-	}
-	return pp, true
-}
-
-func totalLineInPackage(pkg *packages.Package) int {
-	total := 0
-	seen := make(map[*token.File]bool)
-	for _, f := range pkg.Syntax {
-		tf := pkg.Fset.File(f.Pos())
-		if tf == nil || seen[tf] {
-			continue
-		}
-		seen[tf] = true
-		total += tf.LineCount()
-	}
-	return total
-}
@@ -0,0 +1,912 @@
+package bundler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/format"
+	"go/token"
+	"go/types"
+	"io"
+	"io/fs"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/packages"
+)
+
+type (
+	pkgPath   string
+	pkgPrefix string
+)
+
+// Options configures a bundle run. The zero value bundles the main package
+// in the current directory.
+type Options struct {
+	// Dir is the directory patterns are resolved from; it defaults to the
+	// current directory.
+	Dir string
+	// Patterns selects the packages to load, as for the go command; it
+	// defaults to ".". Run requires them to match a single package.
+	Patterns []string
+	// Overlay maps absolute file paths to contents that replace the files
+	// on disk or add new ones.
+	Overlay map[string][]byte
+	// FS, if set, holds the module to bundle instead of the disk: go.mod in
+	// Dir or a parent of it and the sources, plus any local replacements.
+	// Dir is then a slash-separated path in FS. It cannot be combined with
+	// Overlay.
+	FS fs.FS
+
+	// EliminateDeadCode removes if branches whose condition is constant before tree shaking.
+	EliminateDeadCode bool
+	// Defines overrides package-level constants for dead code elimination,
+	// keyed by constant name or by import path and name ("path.name").
+	Defines map[string]string
+	// StripCalls lists debug-only functions whose call statements are removed,
+	// as "pkgname.Func", "path.Func" or "path.Type.Method".
+	StripCalls []string
+	// PruneFields removes struct fields that no called code reads or writes.
+	PruneFields bool
+	// Order selects the layout of declarations; the zero value is OrderKind.
+	Order Order
+	// Shake selects how reachable declarations are found; the zero value
+	// is ShakeRTA.
+	Shake Shake
+	// Library bundles the target package as a library instead of a command:
+	// no main function is required and the exported names of the target
+	// package stay unprefixed.
+	Library bool
+	// PackageName is the package name of a library bundle; it defaults to
+	// the name of the target package.
+	PackageName string
+	// Roots lists extra reachability roots besides main and init, as "Name"
+	// or "Type.Method" in the target package, optionally qualified by an
+	// import path. A library bundle uses all exported names when it is empty.
+	Roots []string
+	// Prefix, when set in library mode, is prepended to every package-level
+	// name of the target package instead of keeping exported names as they are.
+	Prefix string
+	// PrefixStrategy selects how the prefixes of package-level names are
+	// derived from their packages; the zero value is PrefixName.
+	PrefixStrategy PrefixStrategy
+
+	// Minify shortens identifiers and strips comments and blank lines.
+	Minify bool
+	// WithMetrics adds a comment block with line counts to the header.
+	WithMetrics bool
+	// WithSustainabilityMetrics adds a comment block with CO2 and tree
+	// equivalent estimates to the header.
+	WithSustainabilityMetrics bool
+	// MaxSize makes bundling fail when the output is larger, in bytes. 0
+	// disables the check.
+	MaxSize int64
+	// Snippet leaves out the header and the package clause, so that the
+	// output can be pasted into an existing file.
+	Snippet bool
+	// OutputHooks are applied in order to the formatted source, after
+	// minification and before the header is added. Each returns the source
+	// passed on to the next one.
+	OutputHooks []func(src []byte) ([]byte, error)
+}
+
+// PrefixStrategy selects the prefix given to the package-level names of each
+// bundled package, such as lib in lib_Func.
+type PrefixStrategy string
+
+const (
+	// PrefixName uses the package name, numbered when several bundled
+	// packages share it: lib_00_Func and lib_01_Func.
+	PrefixName PrefixStrategy = "name"
+	// PrefixPath uses the import path relative to the module of the target
+	// package, so that a name keeps its prefix when packages are added:
+	// ds_uf_Find for module/ds/uf.
+	PrefixPath PrefixStrategy = "path"
+)
+
+// ParsePrefixStrategy returns the prefix strategy named s.
+func ParsePrefixStrategy(s string) (PrefixStrategy, error) {
+	switch p := PrefixStrategy(s); p {
+	case PrefixName, PrefixPath:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown prefix strategy %q (available: %s, %s)", s, PrefixName, PrefixPath)
+}
+
+type bundler struct {
+	// input
+	pkgs []*packages.Package
+	opts Options
+
+	// cache
+	mainPkg   *packages.Package // target package; not named main in library mode
+	topoPkgs  []*packages.Package
+	prefixes  map[pkgPath]pkgPrefix
+	pkgPaths  map[string]pkgPath
+	pkgByPath map[pkgPath]*packages.Package
+	replaced  map[ast.Node]string
+	keptNodes []ast.Node // source node of each entry in report.Kept
+
+	// output
+	bundled *ast.File
+	report  *Report
+}
+
+// generate writes the bundle of the target package of pkgs to w, without
+// formatting it. It rewrites the syntax trees of pkgs.
+func generate(pkgs []*packages.Package, w io.Writer, opts Options) (*Report, error) {
+	// init
+	b := &bundler{pkgs: pkgs, opts: opts, report: newReport()}
+	start := time.Now()
+	if err := b.setup(); err != nil {
+		return nil, err
+	}
+	b.report.addTiming("init", time.Since(start))
+
+	if opts.EliminateDeadCode || len(opts.Defines) > 0 || len(opts.StripCalls) > 0 {
+		start = time.Now()
+		if err := b.eliminateDeadCode(); err != nil {
+			return nil, err
+		}
+		b.report.addTiming("dead code", time.Since(start))
+	}
+
+	// bundle
+	start = time.Now()
+	file, err := b.buildDeclFile()
+	if err != nil {
+		return nil, err
+	}
+	b.report.addTiming("build", time.Since(start))
+
+	start = time.Now()
+	b.applyPrefixes(file)
+	b.report.addTiming("prefix", time.Since(start))
+	b.measureDecls()
+
+	// format
+	start = time.Now()
+	if err := format.Node(w, b.pkgs[0].Fset, b.bundled); err != nil {
+		return nil, err
+	}
+	b.report.addTiming("print", time.Since(start))
+	return b.report, nil
+}
+
+func (b *bundler) setup() error {
+	if err := b.searchMainPkg(); err != nil {
+		return err
+	}
+	b.collectPackageErrors()
+	b.topologicalSortPkgs()
+	b.countTotalLine()
+	b.generatePrefixes()
+	b.initPkgMaps()
+	b.reportPackages()
+	return nil
+}
+
+func (b *bundler) searchMainPkg() error {
+	if b.opts.Library {
+		if len(b.pkgs) == 0 {
+			return errors.New("no package to bundle")
+		}
+		b.mainPkg = b.pkgs[0]
+		return nil
+	}
+	// mainパッケージが複数あることは考慮しない
+	for _, p := range b.pkgs {
+		if p.Name == "main" {
+			b.mainPkg = p
+			return nil
+		}
+	}
+	return errors.New("main package not found")
+}
+
+func (b *bundler) topologicalSortPkgs() {
+	visited := make(map[pkgPath]bool)
+	b.topoPkgs = make([]*packages.Package, 0, 128)
+
+	var dfs func(p *packages.Package)
+	dfs = func(p *packages.Package) {
+
+		// ignore visited package
+		pp := pkgPath(p.PkgPath)
+		if visited[pp] || isStd(pp) {
+			return
+		}
+		visited[pp] = true
+		// p.Imports is a map: visit in import path order so the output is stable
+		for _, path := range slices.Sorted(maps.Keys(p.Imports)) {
+			dfs(p.Imports[path])
+		}
+		b.topoPkgs = append(b.topoPkgs, p)
+	}
+	dfs(b.mainPkg)
+
+	slices.Reverse(b.topoPkgs)
+}
+
+func (b *bundler) collectPackageErrors() {
+	if _, err := stdPackages(); err != nil {
+		b.report.warnf("std packages are looked up in GOROOT: %v", err)
+	}
+	packages.Visit(b.pkgs, nil, func(p *packages.Package) {
+		for _, e := range p.Errors {
+			b.report.warnf("%s: %s", p.PkgPath, e.Error())
+		}
+	})
+}
+
+func (b *bundler) countTotalLine() {
+	b.report.OriginalLines = 0
+	b.report.OriginalBytes = 0
+	for _, p := range b.topoPkgs {
+		lines, size := totalLineInPackage(p)
+		b.report.OriginalLines += lines
+		b.report.OriginalBytes += size
+	}
+}
+
+func (b *bundler) generatePrefixes() {
+	pkgPathsByPkgName := make(map[string][]pkgPath)
+	for _, now := range b.topoPkgs {
+		name, path := b.prefixBase(now), pkgPath(now.PkgPath)
+		pkgPathsByPkgName[name] = append(pkgPathsByPkgName[name], path)
+	}
+
+	// constrcut data
+	b.prefixes = make(map[pkgPath]pkgPrefix, len(b.topoPkgs))
+	for name, paths := range pkgPathsByPkgName {
+		slices.Sort(paths)
+		if len(paths) == 1 {
+			b.prefixes[paths[0]] = pkgPrefix(name)
+			continue
+		}
+		for i, path := range paths {
+			prefix := pkgPrefix(fmt.Sprintf("%s_%02d", name, i))
+			b.prefixes[path] = prefix
+		}
+	}
+}
+
+// prefixBase returns the prefix of pkg before numbering packages sharing it.
+func (b *bundler) prefixBase(pkg *packages.Package) string {
+	if b.opts.PrefixStrategy != PrefixPath || pkg == b.mainPkg {
+		return pkg.Name
+	}
+	rel := pkg.PkgPath
+	if mod := b.mainPkg.Module; mod != nil {
+		if rel == mod.Path {
+			return pkg.Name
+		}
+		rel = strings.TrimPrefix(rel, mod.Path+"/")
+	}
+	prefix := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, rel)
+	if r, _ := utf8.DecodeRuneInString(prefix); !unicode.IsLetter(r) {
+		prefix = "p" + prefix
+	}
+	return prefix
+}
+
+func (b *bundler) initPkgMaps() {
+	b.pkgPaths = make(map[string]pkgPath)
+	b.pkgByPath = make(map[pkgPath]*packages.Package)
+
+	for _, pkg := range b.topoPkgs {
+		for _, f := range pkg.Syntax {
+			pos := pkg.Fset.Position(f.Pos())
+			pp := pkgPath(pkg.PkgPath)
+			fp := filepath.ToSlash(pos.Filename)
+			b.pkgPaths[fp] = pp
+			b.pkgByPath[pp] = pkg
+		}
+	}
+}
+
+func (b *bundler) eliminateDeadCode() error {
+	defines, err := parseDefines(b.opts.Defines)
+	if err != nil {
+		return err
+	}
+	e := &deadCodeEliminator{
+		defines:  defines,
+		strip:    make(map[string]bool, len(b.opts.StripCalls)),
+		defined:  make(map[string]bool),
+		stripped: make(map[string]bool),
+		consts:   make(map[*types.Const]constDecl),
+		values:   make(map[*types.Const]constant.Value),
+	}
+	for _, name := range b.opts.StripCalls {
+		e.strip[name] = true
+	}
+	if len(defines) > 0 {
+		e.collectConsts(b.topoPkgs)
+	}
+	for _, pkg := range b.topoPkgs {
+		e.pkg = pkg
+		if err := e.run(); err != nil {
+			return err
+		}
+	}
+	for _, name := range e.unmatched() {
+		b.report.warnf("%s matched nothing", name)
+	}
+	return nil
+}
+
+func (b *bundler) reportPackages() {
+	if b.mainPkg.Module != nil {
+		b.report.ModuleGoVersion = b.mainPkg.Module.GoVersion
+	}
+	for _, p := range b.topoPkgs {
+		files := make([]string, len(p.CompiledGoFiles))
+		copy(files, p.CompiledGoFiles)
+		b.report.Packages = append(b.report.Packages, PackageReport{
+			Path:   p.PkgPath,
+			Name:   p.Name,
+			Prefix: string(b.prefixes[pkgPath(p.PkgPath)]),
+			Files:  files,
+		})
+	}
+}
+
+// recordDecl adds a package-level declaration to the kept or dropped list of the report.
+// node is the syntax emitted for the declaration when it is kept.
+func (b *bundler) recordDecl(pkg *packages.Package, obj types.Object, node ast.Node, kept bool) {
+	pos := pkg.Fset.Position(obj.Pos())
+	d := DeclReport{
+		Package: pkg.PkgPath,
+		Name:    declName(obj),
+		Kind:    declKind(obj),
+		Pos:     fmt.Sprintf("%s/%s:%d:%d", pkg.PkgPath, filepath.Base(pos.Filename), pos.Line, pos.Column),
+	}
+	if kept {
+		b.report.Kept = append(b.report.Kept, d)
+		b.keptNodes = append(b.keptNodes, node)
+	} else {
+		b.report.Dropped = append(b.report.Dropped, d)
+	}
+}
+
+// roots returns the extra reachability roots: the objects named by
+// Options.Roots, or every exported name of the target package of a library
+// bundle when no roots are given.
+func (b *bundler) roots() ([]types.Object, error) {
+	names := b.opts.Roots
+	if len(names) == 0 {
+		if !b.opts.Library {
+			return nil, nil
+		}
+		scope := b.mainPkg.Types.Scope()
+		for _, name := range scope.Names() {
+			if ast.IsExported(name) {
+				names = append(names, name)
+			}
+		}
+	}
+	roots := make([]types.Object, 0, len(names))
+	for _, name := range names {
+		obj, err := b.resolveRoot(name)
+		if err != nil {
+			return nil, err
+		}
+		roots = append(roots, obj)
+	}
+	return roots, nil
+}
+
+// resolveRoot returns the function, method, type, var or const named by
+// spec: "Name" or "Type.Method" in the target package, or either form
+// qualified by an import path ("path/to/pkg.Name").
+func (b *bundler) resolveRoot(spec string) (types.Object, error) {
+	pkg, name := b.mainPkg, spec
+	path, rest, ok := SplitQualifiedName(spec, func(path string) bool {
+		return b.pkgByPath[pkgPath(path)] != nil
+	})
+	switch {
+	case ok:
+		pkg, name = b.pkgByPath[pkgPath(path)], rest
+	case strings.Contains(spec, "/"):
+		return nil, fmt.Errorf("root %s: no package of the bundle matches its import path", spec)
+	}
+
+	typeName, method, isMethod := strings.Cut(name, ".")
+	obj := pkg.Types.Scope().Lookup(typeName)
+	if obj == nil {
+		return nil, fmt.Errorf("root %s not found in %s", typeName, pkg.PkgPath)
+	}
+	if !isMethod {
+		return obj, nil
+	}
+	if _, ok := obj.(*types.TypeName); !ok {
+		return nil, fmt.Errorf("root %s: %s is not a type", spec, typeName)
+	}
+	m, _, _ := types.LookupFieldOrMethod(obj.Type(), true, pkg.Types, method)
+	fn, ok := m.(*types.Func)
+	if !ok {
+		return nil, fmt.Errorf("root %s: %s has no method %s", spec, typeName, method)
+	}
+	return fn, nil
+}
+
+// SplitQualifiedName splits "importpath.Name", where Name may be
+// "Type.Method", at the longest import path that isPackage accepts. Import
+// paths may contain dots, as in "gopkg.in/yaml.v3", so the split cannot be
+// made by syntax alone. It reports false when no such path exists.
+func SplitQualifiedName(s string, isPackage func(path string) bool) (path, name string, ok bool) {
+	slash := strings.LastIndex(s, "/")
+	for i := len(s) - 2; i > slash+1; i-- {
+		if s[i] == '.' && isPackage(s[:i]) {
+			return s[:i], s[i+1:], true
+		}
+	}
+	return "", "", false
+}
+
+// packageName returns the package name of the bundle.
+func (b *bundler) packageName() string {
+	if !b.opts.Library {
+		return "main"
+	}
+	if b.opts.PackageName != "" {
+		return b.opts.PackageName
+	}
+	return b.mainPkg.Name
+}
+
+// recordField adds a struct field removed by field pruning to the dropped list of the report.
+func (b *bundler) recordField(pkg *packages.Package, typ types.Object, field *types.Var) {
+	pos := pkg.Fset.Position(field.Pos())
+	b.report.Dropped = append(b.report.Dropped, DeclReport{
+		Package: pkg.PkgPath,
+		Name:    typ.Name() + "." + field.Name(),
+		Kind:    "field",
+		Pos:     fmt.Sprintf("%s/%s:%d:%d", pkg.PkgPath, filepath.Base(pos.Filename), pos.Line, pos.Column),
+	})
+}
+
+func (b *bundler) buildDeclFile() (*ast.File, error) {
+	start := time.Now()
+	roots, err := b.roots()
+	if err != nil {
+		return nil, err
+	}
+	reachable, called, err := analyzeReachableDecls(b.mainPkg, b.topoPkgs, roots, b.opts.Shake)
+	if err != nil {
+		return nil, err
+	}
+	var pruner *fieldPruner
+	if b.opts.PruneFields {
+		pruner = newFieldPruner(b.topoPkgs, reachable, called)
+		pruner.run()
+	}
+	b.report.addTiming("analyze", time.Since(start))
+	builder := newFileBuilder(b.mainPkg.Fset, b.pkgPaths, b.opts.Order, b.packageName())
+
+	for _, pkg := range b.topoPkgs {
+		info := pkg.TypesInfo
+		for _, f := range pkg.Syntax {
+			ast.Inspect(f, func(n ast.Node) bool {
+				switch v := n.(type) {
+				case *ast.GenDecl:
+					switch v.Tok {
+					case token.IMPORT:
+						for _, spec := range v.Specs {
+							if importSpec, ok := spec.(*ast.ImportSpec); ok {
+								builder.addImportSpec(importSpec)
+							}
+						}
+						return false
+					case token.TYPE:
+						for _, spec := range v.Specs {
+							if typeSpec, ok := spec.(*ast.TypeSpec); ok {
+								obj, ok := info.Defs[typeSpec.Name]
+								if !ok || obj == nil {
+									continue
+								}
+								if reachable[obj] && pruner != nil {
+									for _, field := range pruner.prunedFields(info, typeSpec) {
+										b.recordField(pkg, obj, field)
+									}
+									typeSpec = pruner.typeSpec(info, typeSpec)
+								}
+								if isPkgLevel(obj) {
+									b.recordDecl(pkg, obj, typeSpec, reachable[obj])
+								}
+								if reachable[obj] {
+									builder.addTypeSpec(typeSpec)
+								}
+							}
+						}
+					case token.VAR:
+						for _, spec := range v.Specs {
+							if varSpec, ok := spec.(*ast.ValueSpec); ok {
+								var used bool
+								for _, name := range varSpec.Names {
+									if obj, ok := info.Defs[name]; ok && isPkgLevel(obj) {
+										b.recordDecl(pkg, obj, varSpec, reachable[obj])
+										if reachable[obj] {
+											used = true
+										}
+									}
+								}
+								if used {
+									varSpec = pruneVarSpec(info, varSpec, reachable)
+									builder.addValueSpec(varSpec)
+								}
+							}
+						}
+					case token.CONST:
+						decl := pruneConstDecl(info, v, reachable)
+						var used bool
+						for _, spec := range v.Specs {
+							if constSpec, ok := spec.(*ast.ValueSpec); ok {
+								for _, name := range constSpec.Names {
+									if obj, ok := info.Defs[name]; ok && isPkgLevel(obj) {
+										b.recordDecl(pkg, obj, decl, reachable[obj])
+										if reachable[obj] {
+											used = true
+										}
+									}
+								}
+							}
+						}
+						if used {
+							builder.addConstDecl(decl)
+						}
+					}
+				case *ast.FuncDecl:
+					obj, ok := info.Defs[v.Name]
+					if !ok || obj == nil {
+						break
+					}
+					if reachable[obj] && pruner != nil {
+						v = pruner.funcDecl(info, v)
+					}
+					b.recordDecl(pkg, obj, v, reachable[obj])
+					if reachable[obj] {
+						if !isFuncNonMethod(obj) {
+							// method
+							builder.addFuncDecl(v)
+							break
+						}
+						// func
+						switch v.Name.Name {
+						case "init":
+							builder.addInitDecl(v)
+						case "main":
+							builder.setMainDecl(v)
+						default:
+							builder.addFuncDecl(v)
+						}
+					}
+				}
+				return true
+			})
+		}
+	}
+	file, err := builder.build()
+	b.bundled = file
+	return file, err
+}
+
+// measureDecls sets the printed size of each kept declaration. Declarations
+// sharing a spec or a const block split its size evenly.
+func (b *bundler) measureDecls() {
+	shared := make(map[ast.Node]int, len(b.keptNodes))
+	for _, n := range b.keptNodes {
+		shared[n]++
+	}
+	sizes := make(map[ast.Node]int, len(shared))
+	for i, n := range b.keptNodes {
+		size, ok := sizes[n]
+		if !ok {
+			var buf bytes.Buffer
+			if err := format.Node(&buf, b.mainPkg.Fset, n); err == nil {
+				size = buf.Len()
+			}
+			sizes[n] = size
+		}
+		b.report.Kept[i].Bytes = size / shared[n]
+	}
+}
+
+func (b *bundler) applyPrefixes(file *ast.File) {
+	b.replaced = make(map[ast.Node]string, 128)
+	astutil.Apply(file, func(c *astutil.Cursor) bool {
+		switch v := c.Node().(type) {
+		case *ast.SelectorExpr:
+			b.rewriteSelector(c, v)
+		case *ast.Ident:
+			b.rewriteIdent(v)
+		}
+		return true
+	}, nil)
+}
+
+func (b *bundler) rewriteSelector(c *astutil.Cursor, n *ast.SelectorExpr) {
+	_, info, ok := b.infoOfNode(n)
+	if !ok {
+		return
+	}
+	if pp, ok := isPkgSelector(n, info); ok {
+		if prefixAdded, ok := b.addPrefix(pp, n.Sel); ok {
+			dst := ast.NewIdent(prefixAdded)
+			dst.NamePos = n.Sel.NamePos
+			c.Replace(dst)
+			b.replaced[n.Sel] = prefixAdded
+		}
+	} else if pp, ok := isEmbeddedSel(n, info); ok {
+		if prefixAdded, ok := b.addPrefix(pp, n.Sel); ok {
+			n.Sel.Name = prefixAdded
+			b.replaced[n.Sel] = prefixAdded
+		}
+	}
+}
+
+func (b *bundler) rewriteIdent(n *ast.Ident) {
+	pkg, info, ok := b.infoOfNode(n)
+	if !ok {
+		return
+	}
+	if isPkgLevelIdent(pkg, info, n) {
+		if prefixAdded, ok := b.addPrefix(pkgPath(pkg.PkgPath), n); ok {
+			n.Name = prefixAdded
+			b.replaced[n] = prefixAdded
+		}
+		return
+	}
+
+	// dot-imported: ident is in pkg's file but defined in a different non-std package
+	if obj := info.Uses[n]; obj != nil {
+		if objPkg := obj.Pkg(); objPkg != nil && objPkg != pkg.Types && obj.Parent() == objPkg.Scope() {
+			pp := pkgPath(objPkg.Path())
+			if !isStd(pp) {
+				if prefixAdded, ok := b.addPrefix(pp, n); ok {
+					n.Name = prefixAdded
+					b.replaced[n] = prefixAdded
+				}
+				return
+			}
+		}
+	}
+
+	if pp, ok := isEmbeddedFieldKey(n, info); ok {
+		if prefixAdded, ok := b.addPrefix(pp, n); ok {
+			n.Name = prefixAdded
+			b.replaced[n] = prefixAdded
+		}
+		return
+	}
+}
+
+func (b *bundler) addPrefix(pp pkgPath, src *ast.Ident) (string, bool) {
+	if cached, ok := b.replaced[src]; ok {
+		return cached, true
+	}
+	if b.opts.Library && pp == pkgPath(b.mainPkg.PkgPath) {
+		if b.opts.Prefix != "" {
+			return b.opts.Prefix + src.Name, true
+		}
+		if ast.IsExported(src.Name) {
+			// the API of a library bundle keeps its names
+			return "", false
+		}
+	}
+	prefix, ok := b.prefixes[pp]
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("%s_%s", string(prefix), src.Name), true
+}
+
+func (b *bundler) infoOfNode(n ast.Node) (*packages.Package, *types.Info, bool) {
+	if n == nil {
+		return nil, nil, false
+	}
+	pos := b.mainPkg.Fset.Position(n.Pos())
+	if !pos.IsValid() {
+		return nil, nil, false
+	}
+
+	path := filepath.ToSlash(pos.Filename)
+	if pp, ok := b.pkgPaths[path]; ok {
+		if pkg := b.pkgByPath[pp]; pkg != nil && pkg.TypesInfo != nil {
+			return pkg, pkg.TypesInfo, true
+		}
+	}
+	return nil, nil, false
+}
+
+func isPkgLevel(obj types.Object) bool {
+	pkg := obj.Pkg()
+	if pkg == nil {
+		return false
+	}
+	return obj.Parent() == pkg.Scope()
+}
+
+func isFuncNonMethod(obj types.Object) bool {
+	fn, ok := obj.(*types.Func)
+	if !ok {
+		return false
+	}
+	sig, ok := fn.Type().(*types.Signature)
+	if !ok {
+		return false
+	}
+	return sig.Recv() == nil
+}
+
+// isPkgSelector returns pkgPath if sel is pkg.Sel
+func isPkgSelector(sel *ast.SelectorExpr, info *types.Info) (pkgPath, bool) {
+	if info.Selections[sel] != nil {
+		// ignore structure field and method
+		return "", false
+	}
+
+	// X should be Ident
+	xid, ok := sel.X.(*ast.Ident)
+	if !ok {
+		return "", false
+	}
+
+	// X should be used at pkgName
+	pkgName, ok := info.Uses[xid].(*types.PkgName)
+	if !ok || pkgName == nil {
+		return "", false
+	}
+
+	p := pkgName.Imported()
+	if p == nil {
+		return "", false
+	}
+
+	//should be non std pkg
+	pp := pkgPath(p.Path())
+	if isStd(pp) {
+		return "", false
+	}
+	return pp, true
+}
+
+func namedTypeOf(t types.Type) *types.Named {
+	switch tt := t.(type) {
+	case *types.Named:
+		return tt
+	case *types.Pointer:
+		if n, ok := tt.Elem().(*types.Named); ok {
+			return n
+		}
+	}
+	return nil
+}
+
+func isEmbeddedSel(sel *ast.SelectorExpr, info *types.Info) (pkgPath, bool) {
+	s := info.Selections[sel]
+	if s == nil || s.Kind() != types.FieldVal {
+		return "", false
+	}
+
+	v, ok := s.Obj().(*types.Var)
+	if !ok || !v.Anonymous() {
+		return "", false
+	}
+
+	named := namedTypeOf(v.Type())
+	if named == nil {
+		return "", false
+	}
+
+	obj := named.Obj()
+	if obj == nil || obj.Pkg() == nil {
+		return "", false
+	}
+	pp := pkgPath(obj.Pkg().Path())
+	if isStd(pp) {
+		return "", false
+	}
+	return pp, true
+}
+
+func isPkgLevelIdent(pkg *packages.Package, info *types.Info, id *ast.Ident) bool {
+	if id == nil || id.Name == "_" {
+		return false
+	}
+
+	var obj types.Object
+	if o := info.Uses[id]; o != nil {
+		obj = o
+	} else if o := info.Defs[id]; o != nil {
+		obj = o
+	} else {
+		return false
+	}
+
+	if obj.Pkg() == nil {
+		return false
+	}
+	return obj.Pkg() == pkg.Types && obj.Parent() == pkg.Types.Scope()
+}
+
+func isEmbeddedFieldKey(id *ast.Ident, info *types.Info) (pkgPath, bool) {
+	obj, ok := info.Uses[id].(*types.Var)
+	if !ok || !obj.Anonymous() {
+		return "", false
+	}
+
+	named := namedTypeOf(obj.Type())
+	if named == nil {
+		return "", false
+	}
+
+	typeObj := named.Obj()
+	if typeObj == nil || typeObj.Pkg() == nil {
+		return "", false
+	}
+
+	pp := pkgPath(typeObj.Pkg().Path())
+	if isStd(pp) {
+		return "", false
+	}
+	return pp, true
+}
+
+func declName(obj types.Object) string {
+	if fn, ok := obj.(*types.Func); ok {
+		if recv := fn.Signature().Recv(); recv != nil {
+			if named := namedTypeOf(recv.Type()); named != nil {
+				return named.Obj().Name() + "." + fn.Name()
+			}
+		}
+	}
+	return obj.Name()
+}
+
+func declKind(obj types.Object) string {
+	switch obj.(type) {
+	case *types.Func:
+		if isFuncNonMethod(obj) {
+			return "func"
+		}
+		return "method"
+	case *types.TypeName:
+		return "type"
+	case *types.Var:
+		return "var"
+	case *types.Const:
+		return "const"
+	}
+	return "unknown"
+}
+
+// totalLineInPackage returns the number of lines and bytes of the package's source files.
+func totalLineInPackage(pkg *packages.Package) (int, int) {
+	lines, size := 0, 0
+	seen := make(map[*token.File]bool)
+	for _, f := range pkg.Syntax {
+		tf := pkg.Fset.File(f.Pos())
+		if tf == nil || seen[tf] {
+			continue
+		}
+		seen[tf] = true
+		lines += tf.LineCount()
+		size += tf.Size()
+	}
+	return lines, size
+}
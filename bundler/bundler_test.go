@@ -0,0 +1,769 @@
+package bundler
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/Atnuhs/go-bundler/internal/cachedir"
+	"golang.org/x/tools/go/packages"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func TestMain(m *testing.M) {
+	os.Exit(m.Run())
+}
+
+func loadTestPackage(t *testing.T, dir string) []*packages.Package {
+	t.Helper()
+	pkgs, err := Load(Options{Dir: filepath.Join("testdata/src", dir)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pkgs
+}
+
+func bundleDir(t *testing.T, dir string) string {
+	t.Helper()
+	pkgs := loadTestPackage(t, dir)
+	var buf strings.Builder
+	if _, err := generate(pkgs, &buf, Options{}); err != nil {
+		t.Fatalf("generate() error = %v", err)
+	}
+	return buf.String()
+}
+
+func assertContains(t *testing.T, output, substr string) {
+	t.Helper()
+	if !strings.Contains(output, substr) {
+		t.Errorf("expected %q in output\ngot:\n%s", substr, output)
+	}
+}
+
+func assertNotContains(t *testing.T, output, substr string) {
+	t.Helper()
+	if strings.Contains(output, substr) {
+		t.Errorf("unexpected %q in output\ngot:\n%s", substr, output)
+	}
+}
+
+func TestGolden(t *testing.T) {
+	tests := []struct {
+		name    string
+		testdir string
+	}{
+		{name: "no dependencies", testdir: "no-deps"},
+		{name: "single dependencies", testdir: "single-deps"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := bundleDir(t, tt.testdir)
+
+			goldenPath := filepath.Join("testdata/golden", tt.testdir+".go")
+			if *update {
+				if err := os.MkdirAll(filepath.Dir(goldenPath), 0755); err != nil {
+					t.Fatalf("mkdir: %v", err)
+				}
+				if err := os.WriteFile(goldenPath, []byte(output), 0644); err != nil {
+					t.Fatalf("write golden: %v", err)
+				}
+				return
+			}
+
+			want, err := os.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatalf("read golden (run with -update to generate): %v", err)
+			}
+			if output != string(want) {
+				t.Errorf("generate() output mismatch\ngot:\n%s\nwant:\n%s", output, string(want))
+			}
+		})
+	}
+}
+
+func TestTreeShaking(t *testing.T) {
+	output := bundleDir(t, "tree-shaking")
+
+	assertContains(t, output, "lib_UsedFunc")
+	assertNotContains(t, output, "lib_UnusedFunc")
+
+	// call-site renaming
+	assertContains(t, output, "lib_UsedFunc()")
+}
+
+func TestShake(t *testing.T) {
+	for _, tt := range []struct {
+		shake  Shake
+		unused bool
+	}{
+		{shake: ShakeRTA},
+		{shake: ShakeSyntactic},
+		{shake: ShakeNone, unused: true},
+	} {
+		t.Run(string(tt.shake), func(t *testing.T) {
+			pkgs := loadTestPackage(t, "tree-shaking")
+			var buf strings.Builder
+			if _, err := generate(pkgs, &buf, Options{Shake: tt.shake}); err != nil {
+				t.Fatalf("generate() error = %v", err)
+			}
+			output := buf.String()
+			assertContains(t, output, "lib_UsedFunc()")
+			if tt.unused {
+				assertContains(t, output, "func lib_UnusedFunc()")
+			} else {
+				assertNotContains(t, output, "lib_UnusedFunc")
+			}
+		})
+	}
+}
+
+func TestDotImport(t *testing.T) {
+	output := bundleDir(t, "dot-import")
+
+	// declarations
+	assertContains(t, output, "lib_LibFunc")
+	assertContains(t, output, "lib_LibStruct")
+	assertContains(t, output, "lib_LibVar")
+	assertContains(t, output, "lib_LibConst")
+	assertContains(t, output, "lib_LibInterface")
+	assertNotContains(t, output, ". \"")
+
+	// call-site renaming: dot-imported idents must also be renamed at usage
+	assertContains(t, output, "defer lib_LibFunc()")
+	assertContains(t, output, "lib_LibStruct{")
+	assertContains(t, output, "_ = lib_LibVar")
+	// const
+	assertContains(t, output, "_ = lib_LibConst")
+	// type annotation
+	assertContains(t, output, "var _ lib_LibInterface = nil")
+	// type assertion
+	assertContains(t, output, "any(s).(lib_LibInterface)")
+	// function signature (param and return type)
+	assertContains(t, output, "func main_useLib(x lib_LibStruct) lib_LibStruct")
+}
+
+func TestDotImportMulti(t *testing.T) {
+	output := bundleDir(t, "dot-import-multi")
+
+	assertNotContains(t, output, ". \"")
+
+	// 2つの異なるパッケージをドットインポートしたとき、それぞれ正しいプレフィックスになる
+	assertContains(t, output, "liba_FuncA")
+	assertContains(t, output, "libb_FuncB")
+	assertContains(t, output, "liba_TypeA")
+	assertContains(t, output, "libb_TypeB")
+}
+
+func TestNameCollision(t *testing.T) {
+	output := bundleDir(t, "name-collision")
+
+	// 同名パッケージ(package lib)が2つある場合、パスのアルファベット順に lib_00, lib_01 が割り当てられる
+	// liba → lib_00, libb → lib_01
+	assertContains(t, output, "lib_00_FuncA")
+	assertContains(t, output, "lib_01_FuncB")
+
+	// call-site renaming
+	assertContains(t, output, "lib_00_FuncA()")
+	assertContains(t, output, "lib_01_FuncB()")
+}
+
+func TestReport(t *testing.T) {
+	pkgs := loadTestPackage(t, "tree-shaking")
+	var buf strings.Builder
+	report, err := generate(pkgs, &buf, Options{})
+	if err != nil {
+		t.Fatalf("generate() error = %v", err)
+	}
+
+	hasDecl := func(decls []DeclReport, name string) bool {
+		for _, d := range decls {
+			if d.Name == name {
+				return true
+			}
+		}
+		return false
+	}
+	if !hasDecl(report.Kept, "UsedFunc") {
+		t.Errorf("expected UsedFunc in kept declarations: %+v", report.Kept)
+	}
+	if !hasDecl(report.Dropped, "UnusedFunc") {
+		t.Errorf("expected UnusedFunc in dropped declarations: %+v", report.Dropped)
+	}
+	if len(report.Packages) != 2 {
+		t.Errorf("len(Packages) = %d, want 2", len(report.Packages))
+	}
+	if report.OriginalLines == 0 || report.OriginalBytes == 0 {
+		t.Errorf("original size not counted: lines=%d bytes=%d", report.OriginalLines, report.OriginalBytes)
+	}
+}
+
+func TestCheckSize(t *testing.T) {
+	pkgs := loadTestPackage(t, "single-deps")
+	var buf strings.Builder
+	report, err := generate(pkgs, &buf, Options{})
+	if err != nil {
+		t.Fatalf("generate() error = %v", err)
+	}
+
+	size := int64(buf.Len())
+	if err := checkSize(size, size, report); err != nil {
+		t.Errorf("checkSize() within budget: %v", err)
+	}
+	err = checkSize(size, size-1, report)
+	if err == nil {
+		t.Fatal("checkSize() should fail over budget")
+	}
+	assertContains(t, err.Error(), "largest declarations")
+	assertContains(t, err.Error(), "func main (")
+	assertContains(t, err.Error(), "github.com/Atnuhs/go-bundler/bundler/testdata/src/single-deps/lib")
+}
+
+func TestMinify(t *testing.T) {
+	output := bundleDir(t, "minify")
+
+	minified, err := Minify([]byte(output))
+	if err != nil {
+		t.Fatalf("Minify() error = %v", err)
+	}
+	got := string(minified)
+	if len(got) >= len(output) {
+		t.Errorf("minified size %d is not smaller than %d", len(got), len(output))
+	}
+
+	assertNotContains(t, got, "lib_")
+	assertNotContains(t, got, "// github.com")
+	// fields printed with %+v keep their names
+	assertContains(t, got, "Name  string\n\tcount int")
+	// exported methods keep their names
+	assertContains(t, got, ".Push(")
+	// blank lines inside raw strings are kept
+	assertContains(t, got, "`usage:\n\n  minify`")
+	assertContains(t, got, "func main() {")
+}
+
+func TestAnnotation(t *testing.T) {
+	output := bundleDir(t, "annotation")
+
+	// //bundler:keep
+	assertContains(t, output, "func lib_Dump(p lib_Point)")
+	assertContains(t, output, "lib_Origin = 0")
+	// //bundler:drop
+	assertNotContains(t, output, "String()")
+	assertContains(t, output, "func (p lib_Point) Sum() int")
+}
+
+func TestAnnotationDropReferenced(t *testing.T) {
+	pkgs := loadTestPackage(t, "annotation-drop-error")
+	var buf strings.Builder
+	_, err := generate(pkgs, &buf, Options{})
+	if err == nil {
+		t.Fatal("generate() should fail when a dropped declaration is referenced")
+	}
+	assertContains(t, err.Error(), "debug is marked //bundler:drop but referenced by main")
+}
+
+func TestAnnotationDropMethod(t *testing.T) {
+	for _, shake := range []Shake{ShakeRTA, ShakeSyntactic, ShakeNone} {
+		pkgs := loadTestPackage(t, "annotation-drop-method-error")
+		var buf strings.Builder
+		_, err := generate(pkgs, &buf, Options{Shake: shake})
+		if err == nil {
+			t.Fatalf("generate() with -shake=%s should fail when a dropped method satisfies an interface", shake)
+		}
+		assertContains(t, err.Error(), "T.String is marked //bundler:drop but may be called through an interface")
+	}
+}
+
+func TestDeadCode(t *testing.T) {
+	bundle := func(opts Options) string {
+		pkgs := loadTestPackage(t, "dead-code")
+		var buf strings.Builder
+		if _, err := generate(pkgs, &buf, opts); err != nil {
+			t.Fatalf("generate() error = %v", err)
+		}
+		return buf.String()
+	}
+
+	output := bundle(Options{EliminateDeadCode: true, StripCalls: []string{"dbg.Printf"}})
+	assertNotContains(t, output, "main_check")
+	assertNotContains(t, output, "main_verbose")
+	assertNotContains(t, output, "dbg_Printf")
+	// sum is only used by the stripped call
+	assertContains(t, output, "_ = sum")
+	assertContains(t, output, "fmt.Println(n, main_debug)")
+	assertNotContains(t, output, `"trace"`)
+
+	output = bundle(Options{Defines: map[string]string{"debug": "true", "level": "3"}})
+	assertContains(t, output, `fmt.Println("trace")`)
+	assertNotContains(t, output, "if main_trace")
+	assertContains(t, output, "main_debug = true")
+	assertContains(t, output, "main_check(n)")
+	assertNotContains(t, output, "main_verbose")
+	assertContains(t, output, "dbg_Printf(")
+}
+
+func TestPruneFields(t *testing.T) {
+	pkgs := loadTestPackage(t, "prune-fields")
+	var buf strings.Builder
+	report, err := generate(pkgs, &buf, Options{PruneFields: true})
+	if err != nil {
+		t.Fatalf("generate() error = %v", err)
+	}
+	output := buf.String()
+
+	assertContains(t, output, "type segtree_SegTree struct {\n\tn    int\n\tdata []int\n}")
+	// RangeAdd is bundled as a method but never called
+	assertContains(t, output, "func (s *segtree_SegTree) RangeAdd(l, r, x int) { panic(\"unreachable\") }")
+	// printed, built without keys and compared
+	assertContains(t, output, "label string")
+	assertContains(t, output, "A, B int")
+	assertContains(t, output, "Weight   int")
+
+	var dropped []string
+	for _, d := range report.Dropped {
+		if d.Kind == "field" {
+			dropped = append(dropped, d.Name)
+		}
+	}
+	if strings.Join(dropped, ",") != "SegTree.lazy" {
+		t.Errorf("dropped fields = %v, want [SegTree.lazy]", dropped)
+	}
+}
+
+func TestPruneSpecs(t *testing.T) {
+	output := bundleDir(t, "prune-specs")
+
+	assertContains(t, output, "main_Monday main_Weekday = 1")
+	assertContains(t, output, "main_Wednesday main_Weekday = 3")
+	assertNotContains(t, output, "main_Sunday")
+	assertNotContains(t, output, "main_Tuesday")
+	assertContains(t, output, "main_GB = 1 << (10 * 3)")
+	assertNotContains(t, output, "main_KB")
+	assertContains(t, output, "main_Lime = 1 * 10")
+	// next() is still evaluated, the second result of pair() is discarded
+	assertContains(t, output, "var main_a, _ = 1, main_next()")
+	assertContains(t, output, "var main_x, _ = main_pair()")
+}
+
+func TestDeterministic(t *testing.T) {
+	entries, err := os.ReadDir("testdata/src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	runs := 5
+	if testing.Short() {
+		runs = 2
+	}
+
+	for _, e := range entries {
+		if !e.IsDir() || strings.HasSuffix(e.Name(), "-error") {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join("testdata/src", e.Name(), "main.go")); err != nil {
+			// not a command
+			continue
+		}
+		t.Run(e.Name(), func(t *testing.T) {
+			// every run loads the packages again, so that nondeterminism
+			// while loading is caught too
+			want := bundleDir(t, e.Name())
+			for i := 1; i < runs; i++ {
+				if got := bundleDir(t, e.Name()); got != want {
+					t.Fatalf("run %d differs from run 0\nrun 0:\n%s\nrun %d:\n%s", i, want, i, got)
+				}
+			}
+		})
+	}
+}
+
+func TestOrder(t *testing.T) {
+	bundle := func(order Order) string {
+		pkgs := loadTestPackage(t, "single-deps")
+		var buf strings.Builder
+		if _, err := generate(pkgs, &buf, Options{Order: order}); err != nil {
+			t.Fatalf("generate() error = %v", err)
+		}
+		return buf.String()
+	}
+	index := func(output, substr string) int {
+		t.Helper()
+		i := strings.Index(output, substr)
+		if i < 0 {
+			t.Fatalf("expected %q in output\ngot:\n%s", substr, output)
+		}
+		return i
+	}
+
+	// kind: all types come before main
+	output := bundle(OrderKind)
+	if index(output, "type lib_LibStruct") > index(output, "func main()") {
+		t.Errorf("kind order: lib types should precede main\n%s", output)
+	}
+
+	// package: the main package section, then the lib section
+	output = bundle(OrderPackage)
+	assertContains(t, output, "// package github.com/Atnuhs/go-bundler/bundler/testdata/src/single-deps/lib\n// files: lib.go\n")
+	if index(output, "func main()") > index(output, "// package github.com/Atnuhs/go-bundler/bundler/testdata/src/single-deps/lib") {
+		t.Errorf("package order: main should precede the lib section\n%s", output)
+	}
+	if index(output, "// package github.com/Atnuhs/go-bundler/bundler/testdata/src/single-deps/lib") > index(output, "type lib_LibStruct") {
+		t.Errorf("package order: lib types should follow the lib banner\n%s", output)
+	}
+
+	// source: main.go in source order, so main precedes its later funcs
+	output = bundle(OrderSource)
+	assertNotContains(t, output, "// package ")
+	if index(output, "func main()") > index(output, "type lib_LibStruct") {
+		t.Errorf("source order: main.go should precede lib.go\n%s", output)
+	}
+
+	if _, err := ParseOrder("random"); err == nil {
+		t.Error("ParseOrder() should reject an unknown order")
+	}
+}
+
+func TestLibrary(t *testing.T) {
+	bundle := func(opts Options) string {
+		pkgs := loadTestPackage(t, "library")
+		var buf strings.Builder
+		opts.Library = true
+		if _, err := generate(pkgs, &buf, opts); err != nil {
+			t.Fatalf("generate() error = %v", err)
+		}
+		return buf.String()
+	}
+
+	output := bundle(Options{})
+	assertContains(t, output, "package ds\n")
+	assertNotContains(t, output, "func main()")
+	// exported names of the target package keep their names
+	assertContains(t, output, "func NewUnionFind(n int) *UnionFind {")
+	assertContains(t, output, "type Stack[T any] struct")
+	assertContains(t, output, "Inf = 1 << 60")
+	// unexported names and dependencies are prefixed
+	assertContains(t, output, "func ds_grow[T any](x T) T")
+	assertContains(t, output, "mathx_Min(x, y)")
+	assertNotContains(t, output, "unused")
+	assertNotContains(t, output, "mathx_Abs")
+
+	output = bundle(Options{PackageName: "dsu", Roots: []string{"UnionFind"}})
+	assertContains(t, output, "package dsu\n")
+	assertContains(t, output, "func (u *UnionFind) Union(x, y int)")
+	assertNotContains(t, output, "NewUnionFind")
+	assertNotContains(t, output, "Stack")
+
+	pkgs := loadTestPackage(t, "library")
+	var buf strings.Builder
+	if _, err := generate(pkgs, &buf, Options{Library: true, Roots: []string{"Missing"}}); err == nil {
+		t.Error("generate() should fail for an unknown root")
+	}
+}
+
+func TestRoots(t *testing.T) {
+	bundle := func(roots ...string) (string, error) {
+		pkgs := loadTestPackage(t, "roots")
+		var buf strings.Builder
+		_, err := generate(pkgs, &buf, Options{Roots: roots})
+		return buf.String(), err
+	}
+
+	output, err := bundle()
+	if err != nil {
+		t.Fatalf("generate() error = %v", err)
+	}
+	assertNotContains(t, output, "main_helper")
+	assertNotContains(t, output, "solvers_SolveA")
+
+	output, err = bundle(
+		"helper",
+		"github.com/Atnuhs/go-bundler/bundler/testdata/src/roots/solvers.SolveA",
+		"github.com/Atnuhs/go-bundler/bundler/testdata/src/roots/solvers.B.Solve",
+		"github.com/Atnuhs/go-bundler/bundler/testdata/src/roots/yaml.v3.Node.Decode",
+	)
+	if err != nil {
+		t.Fatalf("generate() error = %v", err)
+	}
+	assertContains(t, output, "func (yaml_Node) Decode()")
+	assertNotContains(t, output, "yaml_Unused")
+	assertContains(t, output, "func main_helper()")
+	assertContains(t, output, "func solvers_SolveA()")
+	assertContains(t, output, "func (solvers_B) Solve()")
+	assertContains(t, output, "func main() {")
+	assertNotContains(t, output, "solvers_Unused")
+
+	for _, root := range []string{
+		"missing",
+		"helper.Method",
+		"github.com/Atnuhs/go-bundler/bundler/testdata/src/roots/solvers.B.Missing",
+		"github.com/Atnuhs/go-bundler/bundler/testdata/src/other.F",
+		"github.com/Atnuhs/go-bundler/bundler/testdata/src/roots/yaml.Node",
+	} {
+		if _, err := bundle(root); err == nil {
+			t.Errorf("generate() with root %q should fail", root)
+		}
+	}
+}
+
+func TestSplitQualifiedName(t *testing.T) {
+	known := map[string]bool{"gopkg.in/yaml.v3": true, "gopkg.in/yaml": true, "example.com": true}
+	for _, tt := range []struct {
+		s, path, name string
+	}{
+		{"gopkg.in/yaml.v3.Node", "gopkg.in/yaml.v3", "Node"},
+		{"gopkg.in/yaml.v3.Node.Decode", "gopkg.in/yaml.v3", "Node.Decode"},
+		{"gopkg.in/yaml.Node", "gopkg.in/yaml", "Node"},
+		{"example.com.Func", "example.com", "Func"},
+		{"example.com/other.Func", "", ""},
+		{"gopkg.in/yaml.v3", "gopkg.in/yaml", "v3"},
+		{"Type.Method", "", ""},
+	} {
+		path, name, ok := SplitQualifiedName(tt.s, func(path string) bool { return known[path] })
+		if path != tt.path || name != tt.name || ok != (tt.path != "") {
+			t.Errorf("SplitQualifiedName(%q) = %q, %q, %v; want %q, %q", tt.s, path, name, ok, tt.path, tt.name)
+		}
+	}
+}
+
+func TestClonePackages(t *testing.T) {
+	entries, err := os.ReadDir("testdata/src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if !e.IsDir() || strings.HasSuffix(e.Name(), "-error") {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join("testdata/src", e.Name(), "main.go")); err != nil {
+			continue
+		}
+		t.Run(e.Name(), func(t *testing.T) {
+			pkgs := loadTestPackage(t, e.Name())
+			opts := Options{EliminateDeadCode: true, PruneFields: true}
+			bundle := func(pkgs []*packages.Package) string {
+				var buf strings.Builder
+				if _, err := generate(pkgs, &buf, opts); err != nil {
+					t.Fatalf("generate() error = %v", err)
+				}
+				return buf.String()
+			}
+			// clones must leave the loaded syntax untouched for the next bundle
+			want := bundle(clonePackages(pkgs))
+			if got := bundle(clonePackages(pkgs)); got != want {
+				t.Fatalf("second clone differs\nfirst:\n%s\nsecond:\n%s", want, got)
+			}
+			if got := bundle(pkgs); got != want {
+				t.Fatalf("loaded packages differ from the clone\nclone:\n%s\nloaded:\n%s", want, got)
+			}
+		})
+	}
+}
+
+func TestStdCache(t *testing.T) {
+	t.Setenv(cachedir.Env, t.TempDir())
+	set, _, err := loadStdSet()
+	if err != nil {
+		t.Fatalf("loadStdSet() error = %v", err)
+	}
+	if !set["fmt"] || set["github.com/Atnuhs/go-bundler"] {
+		t.Fatalf("loadStdSet() = %d packages, want fmt and no module packages", len(set))
+	}
+
+	env, err := readGoEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := stdCachePath(env)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("std packages were not cached: %v", err)
+	}
+	// the second load must come from the cache
+	if err := os.WriteFile(path, append(data, "cached/only\n"...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if set, _, err := loadStdSet(); err != nil || !set["cached/only"] {
+		t.Errorf("loadStdSet() did not read the cache, err = %v", err)
+	}
+
+	if !inGoroot("fmt") || !inGoroot("internal/poll") {
+		t.Error("inGoroot() = false for a std package")
+	}
+	if inGoroot("github.com/Atnuhs/go-bundler") {
+		t.Error("inGoroot() = true for a module package")
+	}
+}
+
+func TestStdCallbacks(t *testing.T) {
+	// std is loaded without function bodies; what it calls must still count as called
+	pkgs := loadTestPackage(t, "std-callbacks")
+	var buf strings.Builder
+	if _, err := generate(pkgs, &buf, Options{PruneFields: true}); err != nil {
+		t.Fatalf("generate() error = %v", err)
+	}
+	output := buf.String()
+	assertContains(t, output, "!= main_opts.desc")
+	assertContains(t, output, "c.calls++")
+	assertNotContains(t, output, "panic(")
+	assertNotContains(t, output, "limit")
+	assertNotContains(t, output, "spare")
+}
+
+// BenchmarkLoad compares loading std from source with loading it from
+// export data.
+func BenchmarkLoad(b *testing.B) {
+	const dir = "testdata/src/single-deps"
+	b.Run("source", func(b *testing.B) {
+		b.ReportAllocs()
+		cfg := &packages.Config{Mode: loadMode | packages.NeedDeps, Dir: dir}
+		for i := 0; i < b.N; i++ {
+			if _, err := packages.Load(cfg, "."); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("export", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := load(dir, nil, "."); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestRun(t *testing.T) {
+	res, err := Run(Options{Dir: "testdata/src/single-deps"})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	output := string(res.Source)
+	assertContains(t, output, "package main\n")
+	assertContains(t, output, "func main()")
+	if res.Report == nil || res.Report.BundledBytes == 0 {
+		t.Errorf("Run() report = %+v, want the bundled size", res.Report)
+	}
+	if len(res.Diagnostics) != 0 {
+		t.Errorf("Run() diagnostics = %v, want none", res.Diagnostics)
+	}
+	// the toolchain that type-checked the code, not the one of the bundler
+	if env, err := readGoEnv(); err != nil || res.Report.GoVersion != env.GOVERSION {
+		t.Errorf("report go_version = %q, want %q (%v)", res.Report.GoVersion, env.GOVERSION, err)
+	}
+
+	// snippets have no header and no package clause; hooks see the formatted source
+	var hooked []byte
+	res, err = Run(Options{
+		Dir:     "testdata/src/single-deps",
+		Snippet: true,
+		OutputHooks: []func([]byte) ([]byte, error){
+			func(src []byte) ([]byte, error) {
+				hooked = src
+				return append(src, "// hooked\n"...), nil
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	output = string(res.Source)
+	assertNotContains(t, output, "package main")
+	assertNotContains(t, output, "github.com/Atnuhs/go-bundler\n")
+	assertContains(t, output, "// hooked\n")
+	assertContains(t, string(hooked), "package main\n")
+
+	res, err = Run(Options{
+		Dir: "testdata/src/single-deps",
+		OutputHooks: []func([]byte) ([]byte, error){
+			func([]byte) ([]byte, error) { return nil, errors.New("rejected") },
+		},
+	})
+	if err == nil || !strings.Contains(err.Error(), "rejected") || res.Report == nil {
+		t.Errorf("Run() with a failing hook = %v, report %v", err, res.Report)
+	}
+}
+
+func TestRunDiagnostics(t *testing.T) {
+	res, err := Run(Options{FS: fstest.MapFS{
+		"go.mod":  {Data: []byte("module example.com/broken\n\ngo 1.22\n")},
+		"main.go": {Data: []byte("package main\n\nfunc main() {\n\tundefined()\n}\n")},
+	}})
+	if err == nil {
+		t.Fatal("Run() should fail for a package with type errors")
+	}
+	if res == nil || len(res.Diagnostics) != 1 {
+		t.Fatalf("Run() result = %+v, want one diagnostic", res)
+	}
+	d := res.Diagnostics[0]
+	if d.Kind != "type" || d.Package != "example.com/broken" || d.Pos != "main.go:4:2" {
+		t.Errorf("diagnostic = %+v", d)
+	}
+	assertContains(t, d.String(), "undefined: undefined")
+}
+
+func TestFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"go.mod":          {Data: []byte("module example.com/mem\n\ngo 1.22\n")},
+		"cmd/a/main.go":   {Data: []byte("package main\n\nimport \"example.com/mem/lib\"\n\nfunc main() {\n\tprintln(lib.Used())\n}\n")},
+		"lib/lib.go":      {Data: []byte("package lib\n\nfunc Used() int { return 1 }\n\nfunc Unused() int { return 2 }\n")},
+		"lib/lib_test.go": {Data: []byte("package lib\n")},
+	}
+	for _, opts := range []Options{
+		{FS: fsys, Dir: "cmd/a"},
+		{FS: fsys, Patterns: []string{"./cmd/a"}},
+		{FS: fsys, Dir: "lib", Patterns: []string{"../cmd/a"}},
+	} {
+		res, err := Run(opts)
+		if err != nil {
+			t.Fatalf("Run(%q, %q) error = %v", opts.Dir, opts.Patterns, err)
+		}
+		output := string(res.Source)
+		assertContains(t, output, "println(lib_Used())")
+		assertNotContains(t, output, "lib_Unused")
+		// file names are paths in the FS
+		if files := res.Report.Packages[0].Files; len(files) != 1 || files[0] != "cmd/a/main.go" {
+			t.Errorf("files of the main package = %v, want [cmd/a/main.go]", files)
+		}
+	}
+
+	if _, err := Load(Options{FS: fstest.MapFS{"main.go": {Data: []byte("package main\n")}}}); err == nil {
+		t.Error("Load() should fail without go.mod")
+	}
+	if _, err := Load(Options{FS: fsys, Overlay: map[string][]byte{}}); err == nil {
+		t.Error("Load() should reject FS with Overlay")
+	}
+}
+
+func TestBundle(t *testing.T) {
+	pkgs := loadTestPackage(t, "name-collision")
+	for _, tt := range []struct {
+		prefix PrefixStrategy
+		want   []string
+	}{
+		{prefix: PrefixName, want: []string{"lib_00_FuncA()", "lib_01_FuncB()"}},
+		{prefix: PrefixPath, want: []string{
+			"bundler_testdata_src_name_collision_liba_FuncA()",
+			"bundler_testdata_src_name_collision_libb_FuncB()",
+		}},
+	} {
+		t.Run(string(tt.prefix), func(t *testing.T) {
+			// the same loaded packages are bundled every time
+			res, err := Bundle(pkgs, Options{PrefixStrategy: tt.prefix})
+			if err != nil {
+				t.Fatalf("Bundle() error = %v", err)
+			}
+			for _, want := range tt.want {
+				assertContains(t, string(res.Source), want)
+			}
+		})
+	}
+
+	if _, err := ParsePrefixStrategy("hash"); err == nil {
+		t.Error("ParsePrefixStrategy() should reject an unknown strategy")
+	}
+}
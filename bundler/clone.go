@@ -0,0 +1,176 @@
+package bundler
+
+import (
+	"go/ast"
+	"go/types"
+	"reflect"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// clonePackages returns a copy of the import graph of pkgs in which every
+// non-std package has its own syntax trees and type information, so that
+// Bundle, which rewrites them in place, can run on several copies at once.
+// Types and objects are shared; std packages are shared as they are.
+func clonePackages(pkgs []*packages.Package) []*packages.Package {
+	c := &packageCloner{pkgs: make(map[*packages.Package]*packages.Package)}
+	ret := make([]*packages.Package, len(pkgs))
+	for i, pkg := range pkgs {
+		ret[i] = c.clone(pkg)
+	}
+	return ret
+}
+
+type packageCloner struct {
+	pkgs map[*packages.Package]*packages.Package
+}
+
+func (c *packageCloner) clone(pkg *packages.Package) *packages.Package {
+	if p, ok := c.pkgs[pkg]; ok {
+		return p
+	}
+	if isStd(pkgPath(pkg.PkgPath)) {
+		c.pkgs[pkg] = pkg
+		return pkg
+	}
+	p := *pkg
+	c.pkgs[pkg] = &p
+
+	nodes := &astCloner{copies: make(map[pointer]reflect.Value)}
+	p.Syntax = make([]*ast.File, len(pkg.Syntax))
+	for i, f := range pkg.Syntax {
+		p.Syntax[i] = nodes.clone(f).(*ast.File)
+	}
+	if pkg.TypesInfo != nil {
+		p.TypesInfo = nodes.info(pkg.TypesInfo)
+	}
+	p.Imports = make(map[string]*packages.Package, len(pkg.Imports))
+	for path, imp := range pkg.Imports {
+		p.Imports[path] = c.clone(imp)
+	}
+	return &p
+}
+
+// astCloner deep-copies syntax trees and remembers the copy of each node.
+type astCloner struct {
+	copies map[pointer]reflect.Value
+}
+
+// pointer identifies a pointer by its type and address.
+type pointer struct {
+	typ  reflect.Type
+	addr uintptr
+}
+
+func pointerOf(v reflect.Value) pointer {
+	return pointer{typ: v.Type(), addr: v.Pointer()}
+}
+
+func (c *astCloner) clone(n ast.Node) ast.Node {
+	return c.copy(reflect.ValueOf(n)).Interface().(ast.Node)
+}
+
+func (c *astCloner) copy(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return v
+		}
+		if cp, ok := c.copies[pointerOf(v)]; ok {
+			return cp
+		}
+		cp := reflect.New(v.Type().Elem())
+		c.copies[pointerOf(v)] = cp
+		cp.Elem().Set(c.copy(v.Elem()))
+		return cp
+	case reflect.Struct:
+		cp := reflect.New(v.Type()).Elem()
+		cp.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if cp.Field(i).CanSet() {
+				cp.Field(i).Set(c.copy(v.Field(i)))
+			}
+		}
+		return cp
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		cp := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			cp.Index(i).Set(c.copy(v.Index(i)))
+		}
+		return cp
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		cp := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for it := v.MapRange(); it.Next(); {
+			cp.SetMapIndex(it.Key(), c.copy(it.Value()))
+		}
+		return cp
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		cp := reflect.New(v.Type()).Elem()
+		cp.Set(c.copy(v.Elem()))
+		return cp
+	}
+	return v
+}
+
+// node returns the copy of n, or n when it was not copied.
+func node[N ast.Node](c *astCloner, n N) N {
+	v := reflect.ValueOf(n)
+	if v.Kind() != reflect.Pointer {
+		return n
+	}
+	if cp, ok := c.copies[pointerOf(v)]; ok {
+		return cp.Interface().(N)
+	}
+	return n
+}
+
+// info returns a copy of info keyed by the copied nodes.
+func (c *astCloner) info(info *types.Info) *types.Info {
+	ret := &types.Info{
+		Types:        make(map[ast.Expr]types.TypeAndValue, len(info.Types)),
+		Instances:    make(map[*ast.Ident]types.Instance, len(info.Instances)),
+		Defs:         make(map[*ast.Ident]types.Object, len(info.Defs)),
+		Uses:         make(map[*ast.Ident]types.Object, len(info.Uses)),
+		Implicits:    make(map[ast.Node]types.Object, len(info.Implicits)),
+		Selections:   make(map[*ast.SelectorExpr]*types.Selection, len(info.Selections)),
+		Scopes:       make(map[ast.Node]*types.Scope, len(info.Scopes)),
+		FileVersions: make(map[*ast.File]string, len(info.FileVersions)),
+	}
+	for k, v := range info.Types {
+		ret.Types[node(c, k)] = v
+	}
+	for k, v := range info.Instances {
+		ret.Instances[node(c, k)] = v
+	}
+	for k, v := range info.Defs {
+		ret.Defs[node(c, k)] = v
+	}
+	for k, v := range info.Uses {
+		ret.Uses[node(c, k)] = v
+	}
+	for k, v := range info.Implicits {
+		ret.Implicits[node(c, k)] = v
+	}
+	for k, v := range info.Selections {
+		ret.Selections[node(c, k)] = v
+	}
+	for k, v := range info.Scopes {
+		ret.Scopes[node(c, k)] = v
+	}
+	for k, v := range info.FileVersions {
+		ret.FileVersions[node(c, k)] = v
+	}
+	for _, init := range info.InitOrder {
+		ret.InitOrder = append(ret.InitOrder, &types.Initializer{Lhs: init.Lhs, Rhs: node(c, init.Rhs)})
+	}
+	return ret
+}
@@ -0,0 +1,600 @@
+package bundler
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"sort"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// parseDefines parses "name=value" constant overrides. The name is either a
+// constant name or an import path and a constant name ("path.name").
+func parseDefines(defs map[string]string) (map[string]constant.Value, error) {
+	values := make(map[string]constant.Value, len(defs))
+	for name, v := range defs {
+		var value constant.Value
+		switch v {
+		case "true", "false":
+			value = constant.MakeBool(v == "true")
+		default:
+			expr, err := parser.ParseExpr(v)
+			lit, ok := expr.(*ast.BasicLit)
+			if err != nil || !ok {
+				return nil, fmt.Errorf("invalid value %q for constant %s", v, name)
+			}
+			value = constant.MakeFromLiteral(lit.Value, lit.Kind, 0)
+		}
+		values[name] = value
+	}
+	return values, nil
+}
+
+// deadCodeEliminator removes statements that can never run or are
+// configured as debug-only before reachability analysis, so that the code
+// they refer to is shaken too.
+type deadCodeEliminator struct {
+	// input
+	pkg     *packages.Package
+	defines map[string]constant.Value
+	strip   map[string]bool
+
+	// cache
+	defined  map[string]bool
+	stripped map[string]bool
+	blanks   []*ast.AssignStmt // placeholders keeping variables used only by removed code
+	consts   map[*types.Const]constDecl
+	values   map[*types.Const]constant.Value // constants evaluated with overrides
+	iota     int64
+}
+
+// constDecl is the initializer of a package-level constant.
+type constDecl struct {
+	pkg  *packages.Package
+	expr ast.Expr
+	iota int64
+}
+
+// collectConsts records the initializers of the package-level constants of
+// pkgs, so that constants derived from overridden ones can be evaluated again.
+func (e *deadCodeEliminator) collectConsts(pkgs []*packages.Package) {
+	for _, pkg := range pkgs {
+		for _, f := range pkg.Syntax {
+			for _, decl := range f.Decls {
+				gd, ok := decl.(*ast.GenDecl)
+				if !ok || gd.Tok != token.CONST {
+					continue
+				}
+				// specs without values repeat the previous ones
+				var values []ast.Expr
+				for i, spec := range gd.Specs {
+					vs := spec.(*ast.ValueSpec)
+					if len(vs.Values) > 0 {
+						values = vs.Values
+					}
+					for j, name := range vs.Names {
+						c, ok := pkg.TypesInfo.Defs[name].(*types.Const)
+						if ok && j < len(values) {
+							e.consts[c] = constDecl{pkg: pkg, expr: values[j], iota: int64(i)}
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func (e *deadCodeEliminator) info() *types.Info {
+	return e.pkg.TypesInfo
+}
+
+func (e *deadCodeEliminator) run() error {
+	for _, f := range e.pkg.Syntax {
+		if err := e.rewriteConstSpecs(f); err != nil {
+			return err
+		}
+		for _, decl := range f.Decls {
+			e.blanks = e.blanks[:0]
+			ast.Inspect(decl, func(n ast.Node) bool {
+				switch v := n.(type) {
+				case *ast.BlockStmt:
+					v.List = e.simplifyList(v.List)
+				case *ast.CaseClause:
+					v.Body = e.simplifyList(v.Body)
+				case *ast.CommClause:
+					v.Body = e.simplifyList(v.Body)
+				}
+				return true
+			})
+			e.pruneBlanks(decl)
+		}
+	}
+	return nil
+}
+
+// lookupDefine returns the override for a package-level constant.
+func (e *deadCodeEliminator) lookupDefine(c *types.Const) (constant.Value, bool) {
+	if c.Pkg() == nil || c.Parent() != c.Pkg().Scope() {
+		return nil, false
+	}
+	if v, ok := e.defines[c.Pkg().Path()+"."+c.Name()]; ok {
+		return v, true
+	}
+	v, ok := e.defines[c.Name()]
+	return v, ok
+}
+
+// rewriteConstSpecs replaces the values of overridden constants in their declarations.
+func (e *deadCodeEliminator) rewriteConstSpecs(f *ast.File) error {
+	for _, decl := range f.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.CONST {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			vs := spec.(*ast.ValueSpec)
+			for i, name := range vs.Names {
+				c, ok := e.info().Defs[name].(*types.Const)
+				if !ok {
+					continue
+				}
+				v, ok := e.lookupDefine(c)
+				if !ok {
+					continue
+				}
+				e.defined[c.Name()] = true
+				e.defined[c.Pkg().Path()+"."+c.Name()] = true
+				pos := e.pkg.Fset.Position(name.Pos())
+				if !compatibleKinds(c.Val().Kind(), v.Kind()) {
+					return fmt.Errorf("%s: cannot override constant %s of kind %s with %s", pos, c.Name(), c.Val().Kind(), v)
+				}
+				if len(vs.Values) != len(vs.Names) {
+					return fmt.Errorf("%s: cannot override constant %s without an explicit value", pos, c.Name())
+				}
+				vs.Values[i] = constantExpr(v)
+			}
+		}
+	}
+	return nil
+}
+
+func compatibleKinds(want, got constant.Kind) bool {
+	if want == got {
+		return true
+	}
+	numeric := func(k constant.Kind) bool {
+		return k == constant.Int || k == constant.Float || k == constant.Complex
+	}
+	return numeric(want) && numeric(got)
+}
+
+func constantExpr(v constant.Value) ast.Expr {
+	switch v.Kind() {
+	case constant.Bool:
+		return ast.NewIdent(v.ExactString())
+	case constant.String:
+		return &ast.BasicLit{Kind: token.STRING, Value: v.ExactString()}
+	case constant.Float:
+		return &ast.BasicLit{Kind: token.FLOAT, Value: v.ExactString()}
+	case constant.Complex:
+		return &ast.BasicLit{Kind: token.IMAG, Value: v.ExactString()}
+	}
+	return &ast.BasicLit{Kind: token.INT, Value: v.ExactString()}
+}
+
+// eval returns the constant value of expr with overrides applied, or nil.
+func (e *deadCodeEliminator) eval(expr ast.Expr) constant.Value {
+	switch v := expr.(type) {
+	case *ast.ParenExpr:
+		return e.eval(v.X)
+	case *ast.BasicLit:
+		return constant.MakeFromLiteral(v.Value, v.Kind, 0)
+	case *ast.Ident:
+		obj := e.info().Uses[v]
+		if obj == types.Universe.Lookup("iota") {
+			return constant.MakeInt64(e.iota)
+		}
+		return e.evalConst(obj)
+	case *ast.SelectorExpr:
+		return e.evalConst(e.info().Uses[v.Sel])
+	case *ast.UnaryExpr:
+		x := e.eval(v.X)
+		if x == nil {
+			return nil
+		}
+		switch v.Op {
+		case token.NOT, token.SUB, token.ADD, token.XOR:
+			return constant.UnaryOp(v.Op, x, 0)
+		}
+	case *ast.BinaryExpr:
+		return e.evalBinary(v)
+	}
+	return nil
+}
+
+func (e *deadCodeEliminator) evalConst(obj types.Object) constant.Value {
+	c, ok := obj.(*types.Const)
+	if !ok {
+		return nil
+	}
+	if v, ok := e.lookupDefine(c); ok {
+		return v
+	}
+	d, ok := e.consts[c]
+	if len(e.defines) == 0 || !ok {
+		return c.Val()
+	}
+	// a constant may be derived from an overridden one
+	if v, ok := e.values[c]; ok {
+		return v
+	}
+	pkg, iota := e.pkg, e.iota
+	e.pkg, e.iota = d.pkg, d.iota
+	v := e.eval(d.expr)
+	e.pkg, e.iota = pkg, iota
+	if v == nil && !e.dependsOnDefine(d) {
+		// e.g. a conversion, which eval does not handle
+		v = c.Val()
+	}
+	e.values[c] = v
+	return v
+}
+
+// dependsOnDefine reports whether the initializer d refers to an overridden
+// constant, directly or through other constants.
+func (e *deadCodeEliminator) dependsOnDefine(d constDecl) bool {
+	found := false
+	ast.Inspect(d.expr, func(n ast.Node) bool {
+		id, ok := n.(*ast.Ident)
+		if !ok || found {
+			return !found
+		}
+		c, ok := d.pkg.TypesInfo.Uses[id].(*types.Const)
+		if !ok {
+			return true
+		}
+		if _, ok := e.lookupDefine(c); ok {
+			found = true
+		} else if next, ok := e.consts[c]; ok {
+			found = e.dependsOnDefine(next)
+		}
+		return !found
+	})
+	return found
+}
+
+func (e *deadCodeEliminator) evalBinary(expr *ast.BinaryExpr) constant.Value {
+	x := e.eval(expr.X)
+
+	// only the left operand may short-circuit: the right one can have side effects
+	if x != nil && x.Kind() == constant.Bool {
+		switch {
+		case expr.Op == token.LAND && !constant.BoolVal(x):
+			return constant.MakeBool(false)
+		case expr.Op == token.LOR && constant.BoolVal(x):
+			return constant.MakeBool(true)
+		}
+	}
+	y := e.eval(expr.Y)
+	if x == nil || y == nil {
+		return nil
+	}
+
+	switch expr.Op {
+	case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+		if x.Kind() != y.Kind() && !compatibleKinds(x.Kind(), y.Kind()) {
+			return nil
+		}
+		return constant.MakeBool(constant.Compare(x, expr.Op, y))
+	case token.SHL, token.SHR:
+		s, ok := constant.Uint64Val(y)
+		if !ok {
+			return nil
+		}
+		return constant.Shift(x, expr.Op, uint(s))
+	case token.QUO:
+		if x.Kind() == constant.Int && y.Kind() == constant.Int {
+			if constant.Sign(y) == 0 {
+				return nil
+			}
+			return constant.BinaryOp(x, token.QUO_ASSIGN, y)
+		}
+	case token.REM:
+		if constant.Sign(y) == 0 {
+			return nil
+		}
+	}
+	if !compatibleKinds(x.Kind(), y.Kind()) && x.Kind() != y.Kind() {
+		return nil
+	}
+	return constant.BinaryOp(x, expr.Op, y)
+}
+
+// simplifyList removes dead branches and stripped calls from a statement list.
+func (e *deadCodeEliminator) simplifyList(stmts []ast.Stmt) []ast.Stmt {
+	ret := make([]ast.Stmt, 0, len(stmts))
+	for _, stmt := range stmts {
+		switch v := stmt.(type) {
+		case *ast.IfStmt:
+			folded, ok := e.simplifyIf(v)
+			if !ok {
+				ret = append(ret, v)
+				continue
+			}
+			if folded == nil {
+				ret = e.appendBlank(ret, v)
+				continue
+			}
+			ret = e.appendBlank(ret, v, folded)
+			if block, ok := folded.(*ast.BlockStmt); ok && !declaresNames(block) {
+				ret = append(ret, block.List...)
+			} else {
+				ret = append(ret, folded)
+			}
+		case *ast.ExprStmt:
+			if e.isStripped(v.X) {
+				ret = e.appendBlank(ret, v)
+				continue
+			}
+			ret = append(ret, v)
+		case *ast.DeferStmt:
+			if e.isStripped(v.Call) {
+				ret = e.appendBlank(ret, v)
+				continue
+			}
+			ret = append(ret, v)
+		default:
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
+// simplifyIf folds an if statement with a constant condition. It returns the
+// statement replacing it (nil to remove it), and whether it changed anything.
+func (e *deadCodeEliminator) simplifyIf(s *ast.IfStmt) (ast.Stmt, bool) {
+	cond := e.eval(s.Cond)
+	if s.Init != nil || cond == nil || cond.Kind() != constant.Bool {
+		// keep the statement, but its else branch may be folded
+		if elseIf, ok := s.Else.(*ast.IfStmt); ok {
+			if folded, ok := e.simplifyIf(elseIf); ok {
+				s.Else = withBlanks(folded, e.blankFor(elseIf, folded))
+			}
+		}
+		return s, false
+	}
+
+	if constant.BoolVal(cond) {
+		return s.Body, true
+	}
+	switch els := s.Else.(type) {
+	case *ast.BlockStmt:
+		return els, true
+	case *ast.IfStmt:
+		if folded, ok := e.simplifyIf(els); ok {
+			return folded, true
+		}
+		return els, true
+	}
+	return nil, true
+}
+
+// withBlanks prefixes stmt with placeholder assignments, as the else branch of an if statement.
+func withBlanks(stmt ast.Stmt, blanks []*ast.AssignStmt) ast.Stmt {
+	if len(blanks) == 0 {
+		return stmt
+	}
+	block := &ast.BlockStmt{}
+	for _, b := range blanks {
+		block.List = append(block.List, b)
+	}
+	switch v := stmt.(type) {
+	case nil:
+	case *ast.BlockStmt:
+		block.List = append(block.List, v.List...)
+	default:
+		block.List = append(block.List, v)
+	}
+	return block
+}
+
+// declaresNames reports whether splicing the block into its parent could clash with other names.
+func declaresNames(block *ast.BlockStmt) bool {
+	for _, stmt := range block.List {
+		switch v := stmt.(type) {
+		case *ast.DeclStmt, *ast.LabeledStmt:
+			return true
+		case *ast.AssignStmt:
+			if v.Tok == token.DEFINE {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isStripped reports whether expr is a call to a function configured as debug-only.
+func (e *deadCodeEliminator) isStripped(expr ast.Expr) bool {
+	call, ok := expr.(*ast.CallExpr)
+	if !ok || len(e.strip) == 0 {
+		return false
+	}
+	var id *ast.Ident
+	switch fun := ast.Unparen(call.Fun).(type) {
+	case *ast.Ident:
+		id = fun
+	case *ast.SelectorExpr:
+		id = fun.Sel
+	case *ast.IndexExpr:
+		return e.isStripped(&ast.CallExpr{Fun: fun.X})
+	default:
+		return false
+	}
+	fn, ok := e.info().Uses[id].(*types.Func)
+	if !ok || fn.Pkg() == nil {
+		return false
+	}
+	fn = fn.Origin()
+
+	name := fn.Name()
+	if recv := fn.Signature().Recv(); recv != nil {
+		named := namedTypeOf(recv.Type())
+		if named == nil {
+			return false
+		}
+		name = named.Obj().Name() + "." + name
+	}
+	for _, key := range []string{fn.Pkg().Path() + "." + name, fn.Pkg().Name() + "." + name} {
+		if e.strip[key] {
+			e.stripped[key] = true
+			return true
+		}
+	}
+	return false
+}
+
+// appendBlank appends a placeholder assignment for local variables referred to
+// by removed, but not by kept, so that they do not become unused.
+func (e *deadCodeEliminator) appendBlank(stmts []ast.Stmt, removed ast.Node, kept ...ast.Node) []ast.Stmt {
+	for _, blank := range e.blankFor(removed, kept...) {
+		stmts = append(stmts, blank)
+	}
+	return stmts
+}
+
+func (e *deadCodeEliminator) blankFor(removed ast.Node, kept ...ast.Node) []*ast.AssignStmt {
+	keptIdents := make(map[*ast.Ident]bool)
+	for _, k := range kept {
+		if k == nil {
+			continue
+		}
+		ast.Inspect(k, func(n ast.Node) bool {
+			if id, ok := n.(*ast.Ident); ok {
+				keptIdents[id] = true
+			}
+			return true
+		})
+	}
+
+	blank := &ast.AssignStmt{Tok: token.ASSIGN, TokPos: removed.Pos()}
+	seen := make(map[types.Object]bool)
+	ast.Inspect(removed, func(n ast.Node) bool {
+		id, ok := n.(*ast.Ident)
+		if !ok || keptIdents[id] {
+			return true
+		}
+		v, ok := e.info().Uses[id].(*types.Var)
+		if !ok || v.IsField() || seen[v] || isPkgLevel(v) {
+			return true
+		}
+		if v.Pos() >= removed.Pos() && v.Pos() < removed.End() {
+			// declared inside the removed code
+			return true
+		}
+		seen[v] = true
+
+		use := &ast.Ident{Name: id.Name, NamePos: id.NamePos}
+		e.info().Uses[use] = v
+		e.info().Types[use] = e.info().Types[id]
+		blank.Lhs = append(blank.Lhs, &ast.Ident{Name: "_", NamePos: id.NamePos})
+		blank.Rhs = append(blank.Rhs, use)
+		return true
+	})
+	if len(blank.Rhs) == 0 {
+		return nil
+	}
+	e.blanks = append(e.blanks, blank)
+	return []*ast.AssignStmt{blank}
+}
+
+// pruneBlanks drops placeholder operands for variables that are still used
+// elsewhere in decl, and placeholders left empty.
+func (e *deadCodeEliminator) pruneBlanks(decl ast.Decl) {
+	if len(e.blanks) == 0 {
+		return
+	}
+	isBlank := make(map[*ast.AssignStmt]bool, len(e.blanks))
+	for _, b := range e.blanks {
+		isBlank[b] = true
+	}
+
+	// count uses that keep a variable alive: not placeholders, not assignment targets
+	targets := make(map[*ast.Ident]bool)
+	uses := make(map[types.Object]int)
+	ast.Inspect(decl, func(n ast.Node) bool {
+		switch v := n.(type) {
+		case *ast.AssignStmt:
+			if isBlank[v] {
+				return false
+			}
+			for _, lhs := range v.Lhs {
+				if id, ok := lhs.(*ast.Ident); ok {
+					targets[id] = true
+				}
+			}
+		case *ast.IncDecStmt:
+			if id, ok := v.X.(*ast.Ident); ok {
+				targets[id] = true
+			}
+		case *ast.Ident:
+			if obj := e.info().Uses[v]; obj != nil && !targets[v] {
+				uses[obj]++
+			}
+		}
+		return true
+	})
+
+	for _, b := range e.blanks {
+		lhs, rhs := b.Lhs[:0], b.Rhs[:0]
+		for i, r := range b.Rhs {
+			if uses[e.info().Uses[r.(*ast.Ident)]] == 0 {
+				lhs, rhs = append(lhs, b.Lhs[i]), append(rhs, r)
+			}
+		}
+		b.Lhs, b.Rhs = lhs, rhs
+	}
+
+	ast.Inspect(decl, func(n ast.Node) bool {
+		switch v := n.(type) {
+		case *ast.BlockStmt:
+			v.List = dropEmptyBlanks(v.List, isBlank)
+		case *ast.CaseClause:
+			v.Body = dropEmptyBlanks(v.Body, isBlank)
+		case *ast.CommClause:
+			v.Body = dropEmptyBlanks(v.Body, isBlank)
+		}
+		return true
+	})
+}
+
+func dropEmptyBlanks(stmts []ast.Stmt, isBlank map[*ast.AssignStmt]bool) []ast.Stmt {
+	ret := stmts[:0]
+	for _, stmt := range stmts {
+		if as, ok := stmt.(*ast.AssignStmt); ok && isBlank[as] && len(as.Rhs) == 0 {
+			continue
+		}
+		ret = append(ret, stmt)
+	}
+	return ret
+}
+
+// unmatched returns the constant overrides and debug-only functions which matched nothing.
+func (e *deadCodeEliminator) unmatched() []string {
+	var names []string
+	for name := range e.defines {
+		if !e.defined[name] {
+			names = append(names, "constant "+name)
+		}
+	}
+	for name := range e.strip {
+		if !e.stripped[name] {
+			names = append(names, "function "+name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,31 @@
+// Package bundler bundles a Go package and the non-std packages it imports
+// into a single source file, keeping only the declarations it can reach.
+//
+// Run loads and bundles a package in one call:
+//
+//	res, err := bundler.Run(bundler.Options{Dir: "./abc123/a", Minify: true})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	os.Stdout.Write(res.Source)
+//
+// Tools that bundle the same packages repeatedly load them once with Load
+// and call Bundle, which leaves them unmodified.
+//
+// A module that only exists in memory is bundled from Options.FS, e.g. an
+// fstest.MapFS holding go.mod and the sources.
+//
+// # Stability
+//
+// The exported API of this package (Options and its constants, Result,
+// Diagnostic, Report and the types it refers to, Run, Load, Bundle, Minify,
+// SplitQualifiedName and the Parse functions) follows semantic versioning:
+// it will not change incompatibly before a new major version. Fields may be
+// added to Options, Result and Report, so construct them with field names.
+// Load and Bundle pass *packages.Package of golang.org/x/tools/go/packages,
+// which is not covered: its fields follow that module, whose version may be
+// raised in any release. Treat the packages as opaque between Load and
+// Bundle. The bundled source is not part of the promise: tree shaking and
+// naming may improve in any release, and the contents of Report.Warnings and
+// error messages may change.
+package bundler
@@ -0,0 +1,350 @@
+package bundler
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// fieldPruner removes struct fields that are never read or written by code
+// that may run. Fields of a type are all kept when the type is observed by
+// reflection (converted to an interface, tagged or converted to another
+// struct type), built by a composite literal without keys, compared, used
+// as a map key or passed to unsafe.Sizeof and friends.
+//
+// A bundled method that is never called may still refer to a pruned field;
+// its body is replaced with a panic so that the bundle compiles.
+type fieldPruner struct {
+	// input
+	pkgs      []*packages.Package
+	reachable map[types.Object]bool
+	called    map[types.Object]bool
+
+	// cache
+	reflected *typeObserver // types observed by reflection
+	compared  *typeObserver // types whose values are compared or measured
+	unkeyed   map[*types.TypeName]bool
+	used      map[*types.Var]bool
+
+	// output
+	pruned map[*types.Var]bool
+}
+
+func newFieldPruner(pkgs []*packages.Package, reachable, called map[types.Object]bool) *fieldPruner {
+	newObserver := func() *typeObserver {
+		return &typeObserver{
+			observed: make(map[*types.TypeName]bool),
+			visited:  make(map[types.Type]bool),
+		}
+	}
+	return &fieldPruner{
+		pkgs:      pkgs,
+		reachable: reachable,
+		called:    called,
+		reflected: newObserver(),
+		compared:  newObserver(),
+		unkeyed:   make(map[*types.TypeName]bool),
+		used:      make(map[*types.Var]bool),
+		pruned:    make(map[*types.Var]bool),
+	}
+}
+
+func (p *fieldPruner) run() {
+	for _, pkg := range p.pkgs {
+		info := pkg.TypesInfo
+		p.reflected.info = info
+		p.compared.info = info
+		for _, f := range pkg.Syntax {
+			for _, decl := range f.Decls {
+				for _, n := range p.liveNodes(info, decl) {
+					p.reflected.inspect(n)
+					p.inspect(info, n)
+				}
+			}
+		}
+	}
+	for _, o := range []*typeObserver{p.reflected, p.compared} {
+		if !o.typeParamEscapes {
+			continue
+		}
+		for _, pkg := range p.pkgs {
+			for _, inst := range pkg.TypesInfo.Instances {
+				for i := 0; i < inst.TypeArgs.Len(); i++ {
+					o.mark(inst.TypeArgs.At(i))
+				}
+			}
+		}
+	}
+
+	for _, pkg := range p.pkgs {
+		info := pkg.TypesInfo
+		for _, f := range pkg.Syntax {
+			ast.Inspect(f, func(n ast.Node) bool {
+				ts, ok := n.(*ast.TypeSpec)
+				if !ok {
+					return true
+				}
+				st, ok := ts.Type.(*ast.StructType)
+				obj, _ := info.Defs[ts.Name].(*types.TypeName)
+				if !ok || obj == nil || !p.reachable[obj] || !p.prunable(obj) {
+					return false
+				}
+				for _, field := range st.Fields.List {
+					for _, name := range field.Names {
+						if v, ok := info.Defs[name].(*types.Var); ok && name.Name != "_" && !p.used[v] {
+							p.pruned[v] = true
+						}
+					}
+				}
+				return false
+			})
+		}
+	}
+}
+
+// liveNodes returns the parts of decl that are bundled and may run: specs
+// of bundled declarations are always evaluated, functions only when RTA
+// found a call.
+func (p *fieldPruner) liveNodes(info *types.Info, decl ast.Decl) []ast.Node {
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		if p.isCalled(info, d) {
+			return []ast.Node{d}
+		}
+	case *ast.GenDecl:
+		var nodes []ast.Node
+		for _, spec := range d.Specs {
+			switch s := spec.(type) {
+			case *ast.TypeSpec:
+				if p.reachable[info.Defs[s.Name]] {
+					nodes = append(nodes, s)
+				}
+			case *ast.ValueSpec:
+				for _, name := range s.Names {
+					if p.reachable[info.Defs[name]] {
+						nodes = append(nodes, s)
+						break
+					}
+				}
+			}
+		}
+		return nodes
+	}
+	return nil
+}
+
+func (p *fieldPruner) isCalled(info *types.Info, fd *ast.FuncDecl) bool {
+	obj, ok := info.Defs[fd.Name].(*types.Func)
+	if !ok || !p.reachable[obj] {
+		return false
+	}
+	if fd.Recv == nil && (fd.Name.Name == "init" || fd.Name.Name == "main") {
+		return true
+	}
+	return p.called[obj]
+}
+
+func (p *fieldPruner) prunable(obj *types.TypeName) bool {
+	return !p.reflected.observed[obj] && !p.compared.observed[obj] && !p.unkeyed[obj]
+}
+
+func (p *fieldPruner) inspect(info *types.Info, root ast.Node) {
+	ast.Inspect(root, func(n ast.Node) bool {
+		switch v := n.(type) {
+		case *ast.Ident:
+			if field, ok := info.Uses[v].(*types.Var); ok && field.IsField() {
+				p.used[field.Origin()] = true
+			}
+			if inst, ok := info.Instances[v]; ok {
+				// std generics are not inspected and may compare their type arguments
+				if obj := info.Uses[v]; obj != nil && obj.Pkg() != nil && isStd(pkgPath(obj.Pkg().Path())) {
+					for i := 0; i < inst.TypeArgs.Len(); i++ {
+						p.compared.mark(inst.TypeArgs.At(i))
+					}
+				}
+			}
+		case *ast.BinaryExpr:
+			if v.Op == token.EQL || v.Op == token.NEQ {
+				p.compared.mark(info.TypeOf(v.X))
+				p.compared.mark(info.TypeOf(v.Y))
+			}
+		case *ast.SwitchStmt:
+			if v.Tag != nil {
+				p.compared.mark(info.TypeOf(v.Tag))
+			}
+		case *ast.MapType:
+			p.compared.mark(info.TypeOf(v.Key))
+		case *ast.CallExpr:
+			if isUnsafeBuiltin(info, v.Fun) {
+				for _, arg := range v.Args {
+					if sel, ok := arg.(*ast.SelectorExpr); ok {
+						p.compared.mark(info.TypeOf(sel.X))
+					}
+					p.compared.mark(info.TypeOf(arg))
+				}
+			}
+		case *ast.CompositeLit:
+			if obj := unkeyedStruct(info, v); obj != nil {
+				p.unkeyed[obj] = true
+			}
+		}
+		return true
+	})
+}
+
+// typeSpec returns ts without its pruned fields.
+func (p *fieldPruner) typeSpec(info *types.Info, ts *ast.TypeSpec) *ast.TypeSpec {
+	st, ok := ts.Type.(*ast.StructType)
+	if !ok {
+		return ts
+	}
+	list := make([]*ast.Field, 0, len(st.Fields.List))
+	changed := false
+	for _, field := range st.Fields.List {
+		if len(field.Names) == 0 {
+			list = append(list, field)
+			continue
+		}
+		names := make([]*ast.Ident, 0, len(field.Names))
+		for _, name := range field.Names {
+			if v, ok := info.Defs[name].(*types.Var); ok && p.pruned[v] {
+				continue
+			}
+			names = append(names, name)
+		}
+		if len(names) == len(field.Names) {
+			list = append(list, field)
+			continue
+		}
+		changed = true
+		if len(names) > 0 {
+			f := *field
+			f.Names = names
+			list = append(list, &f)
+		}
+	}
+	if !changed {
+		return ts
+	}
+
+	fields := *st.Fields
+	fields.List = list
+	pruned := *st
+	pruned.Fields = &fields
+	spec := *ts
+	spec.Type = &pruned
+	return &spec
+}
+
+// funcDecl returns fd with a panicking body when it is never called but
+// refers to a pruned field.
+func (p *fieldPruner) funcDecl(info *types.Info, fd *ast.FuncDecl) *ast.FuncDecl {
+	if fd.Body == nil || p.isCalled(info, fd) || !p.refersPruned(info, fd.Body) {
+		return fd
+	}
+	body := &ast.BlockStmt{
+		Lbrace: fd.Body.Lbrace,
+		List: []ast.Stmt{
+			&ast.ExprStmt{X: &ast.CallExpr{
+				Fun:  ast.NewIdent("panic"),
+				Args: []ast.Expr{&ast.BasicLit{Kind: token.STRING, Value: `"unreachable"`}},
+			}},
+		},
+	}
+	decl := *fd
+	decl.Body = body
+	return &decl
+}
+
+func (p *fieldPruner) refersPruned(info *types.Info, root ast.Node) bool {
+	found := false
+	ast.Inspect(root, func(n ast.Node) bool {
+		if found {
+			return false
+		}
+		switch v := n.(type) {
+		case *ast.Ident:
+			if field, ok := info.Uses[v].(*types.Var); ok && p.pruned[field.Origin()] {
+				found = true
+			}
+		case *ast.CompositeLit:
+			// positional elements no longer match the fields
+			if obj := unkeyedStruct(info, v); obj != nil && p.hasPruned(obj) {
+				found = true
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+func (p *fieldPruner) hasPruned(obj *types.TypeName) bool {
+	st, ok := underlying(obj.Type()).(*types.Struct)
+	if !ok {
+		return false
+	}
+	for i := 0; i < st.NumFields(); i++ {
+		if p.pruned[st.Field(i)] {
+			return true
+		}
+	}
+	return false
+}
+
+// prunedFields returns the pruned fields of the struct type declared by ts.
+func (p *fieldPruner) prunedFields(info *types.Info, ts *ast.TypeSpec) []*types.Var {
+	obj, ok := info.Defs[ts.Name].(*types.TypeName)
+	if !ok {
+		return nil
+	}
+	st, ok := underlying(obj.Type()).(*types.Struct)
+	if !ok {
+		return nil
+	}
+	var fields []*types.Var
+	for i := 0; i < st.NumFields(); i++ {
+		if p.pruned[st.Field(i)] {
+			fields = append(fields, st.Field(i))
+		}
+	}
+	return fields
+}
+
+// unkeyedStruct returns the named struct type built by lit when its elements have no keys.
+func unkeyedStruct(info *types.Info, lit *ast.CompositeLit) *types.TypeName {
+	if len(lit.Elts) == 0 {
+		return nil
+	}
+	if _, ok := lit.Elts[0].(*ast.KeyValueExpr); ok {
+		return nil
+	}
+	named := namedTypeOf(info.TypeOf(lit))
+	if named == nil || !isStruct(named) {
+		return nil
+	}
+	return named.Origin().Obj()
+}
+
+// isUnsafeBuiltin reports whether fun is unsafe.Sizeof, unsafe.Alignof or unsafe.Offsetof.
+func isUnsafeBuiltin(info *types.Info, fun ast.Expr) bool {
+	var id *ast.Ident
+	switch f := fun.(type) {
+	case *ast.SelectorExpr:
+		id = f.Sel
+	case *ast.Ident:
+		id = f
+	default:
+		return false
+	}
+	b, ok := info.Uses[id].(*types.Builtin)
+	if !ok {
+		return false
+	}
+	switch b.Name() {
+	case "Sizeof", "Alignof", "Offsetof":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,329 @@
+package bundler
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Order selects how declarations are laid out in the bundle.
+type Order string
+
+const (
+	// OrderKind groups declarations by kind: types, vars, consts, main and funcs.
+	OrderKind Order = "kind"
+	// OrderPackage groups declarations by package, each section starting with a banner.
+	OrderPackage Order = "package"
+	// OrderSource keeps declarations in the order they appear in the sources.
+	OrderSource Order = "source"
+)
+
+func ParseOrder(s string) (Order, error) {
+	switch o := Order(s); o {
+	case OrderKind, OrderPackage, OrderSource:
+		return o, nil
+	}
+	return "", fmt.Errorf("unknown order %q (available: %s, %s, %s)", s, OrderKind, OrderPackage, OrderSource)
+}
+
+type fileBuilder struct {
+	// input
+	fset       *token.FileSet
+	filePkgMap map[string]pkgPath
+	order      Order
+	pkgName    string
+
+	// cache
+	stdImports map[pkgPath]*ast.ImportSpec
+	typeSpecs  []*ast.TypeSpec
+	valueSpecs []*ast.ValueSpec
+	constDecls []*ast.GenDecl // constはiotaとかあるのでdecl単位
+	initDecls  []*ast.FuncDecl
+	mainDecl   *ast.FuncDecl
+	funcDecls  []*ast.FuncDecl
+	added      []ast.Node // declarations in the order they were added
+}
+
+func newFileBuilder(fset *token.FileSet, paths map[string]pkgPath, order Order, pkgName string) *fileBuilder {
+	if order == "" {
+		order = OrderKind
+	}
+	return &fileBuilder{
+		fset:       fset,
+		filePkgMap: paths,
+		order:      order,
+		pkgName:    pkgName,
+		stdImports: make(map[pkgPath]*ast.ImportSpec, 128),
+		typeSpecs:  make([]*ast.TypeSpec, 0),
+		valueSpecs: make([]*ast.ValueSpec, 0),
+		constDecls: make([]*ast.GenDecl, 0),
+		initDecls:  make([]*ast.FuncDecl, 0),
+		funcDecls:  make([]*ast.FuncDecl, 0),
+	}
+}
+
+func (b *fileBuilder) commentGroup(t token.Pos) *ast.CommentGroup {
+	pos := b.fset.Position(t)
+	fp := filepath.ToSlash(pos.Filename)
+	name := filepath.Base(fp)
+	var pp pkgPath
+	var ok bool
+	pp, ok = b.filePkgMap[fp]
+	if !ok {
+		pp = "unknown"
+	}
+
+	return &ast.CommentGroup{
+		List: []*ast.Comment{
+			{Text: fmt.Sprintf("// %s/%s:%d:%d", pp, name, pos.Line, pos.Column)},
+		},
+	}
+}
+
+func (b *fileBuilder) addImportSpec(n *ast.ImportSpec) {
+	path := pkgPath(strings.Trim(n.Path.Value, `"`))
+	// keep the first spec in traversal order
+	if _, ok := b.stdImports[path]; !ok && isStd(path) {
+		b.stdImports[path] = n
+	}
+}
+
+func (b *fileBuilder) addTypeSpec(n *ast.TypeSpec) {
+	b.typeSpecs = append(b.typeSpecs, n)
+	b.added = append(b.added, n)
+}
+
+func (b *fileBuilder) addValueSpec(n *ast.ValueSpec) {
+	b.valueSpecs = append(b.valueSpecs, n)
+	b.added = append(b.added, n)
+}
+
+func (b *fileBuilder) addConstDecl(n *ast.GenDecl) {
+	if n.Tok == token.CONST {
+		b.constDecls = append(b.constDecls, n)
+		b.added = append(b.added, n)
+	}
+}
+
+func (b *fileBuilder) addInitDecl(n *ast.FuncDecl) {
+	b.initDecls = append(b.initDecls, n)
+	b.added = append(b.added, n)
+}
+
+func (b *fileBuilder) setMainDecl(n *ast.FuncDecl) {
+	b.mainDecl = n
+	b.added = append(b.added, n)
+}
+
+func (b *fileBuilder) addFuncDecl(n *ast.FuncDecl) {
+	b.funcDecls = append(b.funcDecls, n)
+	b.added = append(b.added, n)
+}
+
+func (b *fileBuilder) build() (*ast.File, error) {
+	// check required values
+	if b.mainDecl == nil && b.pkgName == "main" {
+		return nil, errors.New("main function not found")
+	}
+
+	file := &ast.File{
+		Name: ast.NewIdent(b.pkgName),
+	}
+
+	// add imports
+	if len(b.stdImports) > 0 {
+		importDecl := &ast.GenDecl{
+			Tok:   token.IMPORT,
+			Specs: make([]ast.Spec, 0, len(b.stdImports)),
+		}
+		paths := make([]string, 0, len(b.stdImports))
+		for p := range b.stdImports {
+			paths = append(paths, string(p))
+		}
+		sort.Strings(paths)
+		for _, p := range paths {
+			importDecl.Specs = append(importDecl.Specs, b.stdImports[pkgPath(p)])
+		}
+		file.Decls = append(file.Decls, importDecl)
+
+	}
+
+	// add inits
+	if len(b.initDecls) > 0 {
+		initDecl := &ast.FuncDecl{
+			Name: ast.NewIdent("init"),
+			Type: &ast.FuncType{
+				Params: &ast.FieldList{},
+			},
+			Body: &ast.BlockStmt{
+				List: []ast.Stmt{},
+			},
+		}
+		file.Decls = append(file.Decls, initDecl)
+		for _, d := range b.initDecls {
+			stmt := &ast.ExprStmt{
+				X: &ast.CallExpr{
+					Fun: d.Name,
+				},
+			}
+			initDecl.Body.List = append(initDecl.Body.List, stmt)
+		}
+	}
+
+	// wrap specs into declarations
+	decls := make(map[ast.Node]ast.Decl, len(b.added))
+	for _, v := range b.typeSpecs {
+		decls[v] = &ast.GenDecl{
+			Tok:   token.TYPE,
+			Specs: []ast.Spec{v},
+			Doc:   b.commentGroup(v.Pos()),
+		}
+	}
+	for _, v := range b.valueSpecs {
+		decls[v] = &ast.GenDecl{
+			Tok:   token.VAR,
+			Specs: []ast.Spec{v},
+			Doc:   b.commentGroup(v.Pos()),
+		}
+	}
+	for _, d := range b.constDecls {
+		d.Doc = b.commentGroup(d.Pos())
+		decls[d] = d
+	}
+	if b.mainDecl != nil {
+		decls[b.mainDecl] = &ast.FuncDecl{
+			Name: ast.NewIdent("main"),
+			Type: &ast.FuncType{
+				Params: &ast.FieldList{},
+			},
+			Body: b.mainDecl.Body,
+			Doc:  b.commentGroup(b.mainDecl.Pos()),
+		}
+	}
+	for _, d := range b.funcDecls {
+		d.Doc = b.commentGroup(d.Pos())
+		decls[d] = d
+	}
+	for _, d := range b.initDecls {
+		decls[d] = d
+	}
+
+	switch b.order {
+	case OrderSource:
+		for _, n := range b.added {
+			file.Decls = append(file.Decls, decls[n])
+		}
+	case OrderPackage:
+		file.Decls = append(file.Decls, b.packageSections(decls)...)
+	default:
+		for _, n := range b.kindOrder() {
+			file.Decls = append(file.Decls, decls[n])
+		}
+	}
+
+	return file, nil
+}
+
+// kindOrder returns the added declarations grouped by kind: inits, types,
+// vars, consts, main and funcs.
+func (b *fileBuilder) kindOrder() []ast.Node {
+	nodes := make([]ast.Node, 0, len(b.added))
+	for _, d := range b.initDecls {
+		nodes = append(nodes, d)
+	}
+	for _, v := range b.typeSpecs {
+		nodes = append(nodes, v)
+	}
+	for _, v := range b.valueSpecs {
+		nodes = append(nodes, v)
+	}
+	for _, d := range b.constDecls {
+		nodes = append(nodes, d)
+	}
+	if b.mainDecl != nil {
+		nodes = append(nodes, b.mainDecl)
+	}
+	for _, d := range b.funcDecls {
+		nodes = append(nodes, d)
+	}
+	return nodes
+}
+
+// packageSections returns the declarations grouped by package in the order
+// the packages were first added, each group in kind order and led by a
+// banner naming the package and its files.
+func (b *fileBuilder) packageSections(decls map[ast.Node]ast.Decl) []ast.Decl {
+	var paths []pkgPath
+	sections := make(map[pkgPath][]ast.Decl)
+	for _, n := range b.kindOrder() {
+		pp := b.pkgPathOf(n.Pos())
+		if _, ok := sections[pp]; !ok {
+			paths = append(paths, pp)
+		}
+		sections[pp] = append(sections[pp], decls[n])
+	}
+	slices.SortStableFunc(paths, func(x, y pkgPath) int {
+		return cmp.Compare(b.firstAdded(x), b.firstAdded(y))
+	})
+
+	ret := make([]ast.Decl, 0, len(decls))
+	for _, pp := range paths {
+		section := sections[pp]
+		banner := []*ast.Comment{
+			{Text: fmt.Sprintf("// package %s", pp)},
+			{Text: fmt.Sprintf("// files: %s", strings.Join(b.filesOf(pp), ", "))},
+		}
+		switch d := section[0].(type) {
+		case *ast.GenDecl:
+			d.Doc = withBanner(banner, d.Doc)
+		case *ast.FuncDecl:
+			d.Doc = withBanner(banner, d.Doc)
+		}
+		ret = append(ret, section...)
+	}
+	return ret
+}
+
+func withBanner(banner []*ast.Comment, doc *ast.CommentGroup) *ast.CommentGroup {
+	list := slices.Clone(banner)
+	if doc != nil {
+		list = append(list, doc.List...)
+	}
+	return &ast.CommentGroup{List: list}
+}
+
+func (b *fileBuilder) pkgPathOf(t token.Pos) pkgPath {
+	fp := filepath.ToSlash(b.fset.Position(t).Filename)
+	if pp, ok := b.filePkgMap[fp]; ok {
+		return pp
+	}
+	return "unknown"
+}
+
+// firstAdded returns the index of the first declaration added from pp.
+func (b *fileBuilder) firstAdded(pp pkgPath) int {
+	for i, n := range b.added {
+		if b.pkgPathOf(n.Pos()) == pp {
+			return i
+		}
+	}
+	return len(b.added)
+}
+
+// filesOf returns the sorted base names of the source files of pp.
+func (b *fileBuilder) filesOf(pp pkgPath) []string {
+	var files []string
+	for fp, p := range b.filePkgMap {
+		if p == pp {
+			files = append(files, filepath.Base(fp))
+		}
+	}
+	sort.Strings(files)
+	return files
+}
@@ -0,0 +1,262 @@
+package bundler
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"go/token"
+	"go/types"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/tools/go/gcexportdata"
+	"golang.org/x/tools/go/packages"
+)
+
+// Load loads the packages matching opts.Patterns, resolved from opts.Dir
+// and with the files in opts.Overlay replaced, or from opts.FS. Non-std
+// packages get syntax and type information; std packages only get types,
+// read from export data. Dependencies shared by several packages are loaded
+// once.
+func Load(opts Options) ([]*packages.Package, error) {
+	patterns := opts.Patterns
+	if len(patterns) == 0 {
+		patterns = []string{"."}
+	}
+	dir := opts.Dir
+	if dir == "" {
+		dir = "."
+	}
+	if opts.FS != nil {
+		if opts.Overlay != nil {
+			return nil, errors.New("FS and Overlay cannot be used together")
+		}
+		return loadFS(opts.FS, dir, patterns)
+	}
+	return load(dir, opts.Overlay, patterns...)
+}
+
+// loadFS loads the packages of the module in fsys. The go command needs a
+// working directory, so the files are handed to it as an overlay on an empty
+// temporary directory holding only dir, which is removed afterwards. Other
+// modules in fsys, e.g. replacements or those of a go.work, are found by the
+// go command too. File names in the packages and their errors are then made
+// relative to fsys; positions in the syntax trees keep the temporary names.
+func loadFS(fsys fs.FS, dir string, patterns []string) ([]*packages.Package, error) {
+	if !fs.ValidPath(dir) {
+		return nil, fmt.Errorf("invalid directory %q in FS", dir)
+	}
+	root, err := os.MkdirTemp("", "go-bundler-fs-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(root)
+
+	overlay := make(map[string][]byte)
+	err = fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		overlay[filepath.Join(root, filepath.FromSlash(name))] = data
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read FS: %w", err)
+	}
+	for d := dir; ; d = path.Dir(d) {
+		if _, ok := overlay[filepath.Join(root, filepath.FromSlash(d), "go.mod")]; ok {
+			break
+		}
+		if d == "." {
+			return nil, fmt.Errorf("no go.mod in %s or its parents in FS", dir)
+		}
+	}
+
+	// the go command runs in dir, which must exist
+	cwd := filepath.Join(root, filepath.FromSlash(dir))
+	if err := os.MkdirAll(cwd, 0755); err != nil {
+		return nil, err
+	}
+	pkgs, err := load(cwd, overlay, patterns...)
+	if err != nil {
+		return nil, err
+	}
+
+	rel := func(name string) string {
+		if r, err := filepath.Rel(root, name); err == nil && filepath.IsLocal(r) {
+			return filepath.ToSlash(r)
+		}
+		return name
+	}
+	packages.Visit(pkgs, nil, func(p *packages.Package) {
+		if isStd(pkgPath(p.PkgPath)) {
+			return
+		}
+		for _, files := range [][]string{p.GoFiles, p.CompiledGoFiles} {
+			for i, f := range files {
+				files[i] = rel(f)
+			}
+		}
+		for i, e := range p.Errors {
+			p.Errors[i].Pos = strings.Replace(e.Pos, root+string(filepath.Separator), "", 1)
+		}
+	})
+	return pkgs, nil
+}
+
+// loadMode is what the bundler needs of the packages it bundles.
+const loadMode = packages.NeedName |
+	packages.NeedFiles |
+	packages.NeedSyntax |
+	packages.NeedTypes |
+	packages.NeedTypesInfo |
+	packages.NeedTypesSizes |
+	packages.NeedModule |
+	packages.NeedCompiledGoFiles |
+	packages.NeedImports
+
+// load loads the packages matching the patterns in two phases: the import
+// graph is listed first, then the non-std packages in it are parsed and
+// type-checked from source while std packages only get types, read from
+// export data. SSA then sees std functions without bodies.
+//
+// Files in overlay are read from it instead of the disk.
+func load(dir string, overlay map[string][]byte, patterns ...string) ([]*packages.Package, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get abs path of %s", dir)
+	}
+
+	cfg := &packages.Config{
+		Mode:    loadMode,
+		Dir:     absDir,
+		Tests:   false,
+		Overlay: overlay,
+	}
+
+	graph, err := packages.Load(&packages.Config{
+		Mode:    packages.NeedName | packages.NeedImports | packages.NeedDeps,
+		Dir:     absDir,
+		Overlay: overlay,
+	}, patterns...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list packages: %w", err)
+	}
+	var local []string
+	packages.Visit(graph, nil, func(p *packages.Package) {
+		if !isStd(pkgPath(p.PkgPath)) {
+			local = append(local, p.ID)
+		}
+	})
+	if len(local) == 0 {
+		// only std packages; let the loader report them
+		return graph, nil
+	}
+
+	// every non-std package is a root, so that it gets syntax
+	cfg.Mode |= packages.NeedExportFile
+	all, err := packages.Load(cfg, local...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load package: %w", err)
+	}
+	byID := make(map[string]*packages.Package, len(all))
+	for _, p := range all {
+		byID[p.ID] = p
+	}
+	for _, p := range all {
+		dropBuildErrors(p)
+	}
+	pkgs := make([]*packages.Package, 0, len(graph))
+	for _, p := range graph {
+		if q, ok := byID[p.ID]; ok {
+			pkgs = append(pkgs, q)
+		} else {
+			pkgs = append(pkgs, p)
+		}
+	}
+	if len(overlay) > 0 {
+		// the loader type-checks everything from source when there is an
+		// overlay; std must look the same to SSA as without one
+		packages.Visit(pkgs, nil, func(p *packages.Package) {
+			if isStd(pkgPath(p.PkgPath)) {
+				p.Syntax, p.TypesInfo = nil, nil
+			}
+		})
+	}
+	if err := completeStd(pkgs, all[0].Fset); err != nil {
+		return nil, err
+	}
+	return pkgs, nil
+}
+
+// dropBuildErrors removes the compiler output that the export data request
+// adds to a package that does not compile: its errors are also reported by
+// the type checker, with positions.
+func dropBuildErrors(p *packages.Package) {
+	if len(p.TypeErrors) == 0 {
+		return
+	}
+	errs := p.Errors[:0]
+	for _, e := range p.Errors {
+		if e.Kind != packages.ListError || !strings.HasPrefix(e.Msg, "# ") {
+			errs = append(errs, e)
+		}
+	}
+	p.Errors = errs
+}
+
+// completeStd reads the export data of every std package in the graph. The
+// loader only reads it for packages imported by the non-std ones, which
+// leaves other std packages without types or with only the declarations
+// their importers need, while SSA needs complete packages.
+func completeStd(pkgs []*packages.Package, fset *token.FileSet) error {
+	// reuse the packages created so far so that types stay identical
+	known := make(map[string]*types.Package)
+	var collect func(tp *types.Package)
+	collect = func(tp *types.Package) {
+		if tp == nil || known[tp.Path()] != nil {
+			return
+		}
+		known[tp.Path()] = tp
+		for _, imp := range tp.Imports() {
+			collect(imp)
+		}
+	}
+	packages.Visit(pkgs, nil, func(p *packages.Package) { collect(p.Types) })
+
+	var err error
+	packages.Visit(pkgs, nil, func(p *packages.Package) {
+		if err != nil || p.PkgPath == "unsafe" || !isStd(pkgPath(p.PkgPath)) || p.Types != nil && p.Types.Complete() {
+			return
+		}
+		if p.Types, err = readExportData(p.ExportFile, fset, known, p.PkgPath); err != nil {
+			err = fmt.Errorf("read export data of %s: %w", p.PkgPath, err)
+			return
+		}
+		p.Fset = fset
+	})
+	return err
+}
+
+func readExportData(file string, fset *token.FileSet, known map[string]*types.Package, path string) (*types.Package, error) {
+	if file == "" {
+		return nil, errors.New("no export data")
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r, err := gcexportdata.NewReader(bufio.NewReader(f))
+	if err != nil {
+		return nil, err
+	}
+	return gcexportdata.Read(r, fset, known, path)
+}
@@ -1,4 +1,4 @@
-package main
+package bundler
 
 import (
 	"fmt"
@@ -11,25 +11,25 @@ const (
 	co2PerTreePerYearKg = 20.0
 )
 
-type MetricGenerator struct {
+type metricGenerator struct {
 	originalLine int
 	bundledLine  int
 }
 
-func (g *MetricGenerator) removed() int {
+func (g *metricGenerator) removed() int {
 	return max(0, g.originalLine-g.bundledLine)
 }
 
-func (g *MetricGenerator) reduction() float64 {
+func (g *metricGenerator) reduction() float64 {
 	return float64(g.removed()) / float64(g.originalLine)
 }
 
-func (g *MetricGenerator) WriteHeader(w io.Writer) {
+func (g *metricGenerator) writeHeader(w io.Writer) {
 	fmt.Fprintln(w, `// Code generated by go-bundler; DO NOT EDIT.`)
 	fmt.Fprintln(w)
 }
 
-func (g *MetricGenerator) WriteMetrics(w io.Writer) {
+func (g *metricGenerator) writeMetrics(w io.Writer) {
 	fmt.Fprintln(w, "// go-bundler metrics:")
 	fmt.Fprintf(w, "//   original lines   : %d\n", g.originalLine)
 	fmt.Fprintf(w, "//   bundled  lines   : %d\n", g.bundledLine)
@@ -37,7 +37,7 @@ func (g *MetricGenerator) WriteMetrics(w io.Writer) {
 	fmt.Fprintln(w)
 }
 
-func (g *MetricGenerator) WriteSustainabilityMetrics(w io.Writer) {
+func (g *metricGenerator) writeSustainabilityMetrics(w io.Writer) {
 	pages := float64(g.removed()) / linesPerPrintedPage
 	co2Kg := pages * co2PerPageKg
 	trees := co2Kg / co2PerTreePerYearKg
@@ -54,13 +54,13 @@ func (g *MetricGenerator) WriteSustainabilityMetrics(w io.Writer) {
 	fmt.Fprintln(w)
 }
 
-func (g *MetricGenerator) WriteProjectURL(w io.Writer) {
+func (g *metricGenerator) writeProjectURL(w io.Writer) {
 	fmt.Fprintln(w, "// Project home: https://github.com/Atnuhs/go-bundler")
 	fmt.Fprintln(w)
 }
 
-func NewMetricWriter(ol, bl int) *MetricGenerator {
-	return &MetricGenerator{
+func newMetricGenerator(ol, bl int) *metricGenerator {
+	return &metricGenerator{
 		originalLine: ol,
 		bundledLine:  bl,
 	}
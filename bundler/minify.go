@@ -0,0 +1,493 @@
+package bundler
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"slices"
+	"strings"
+)
+
+// Minify shortens the identifiers of a bundled source file and strips its
+// comments and blank lines. Package-level identifiers, unexported methods,
+// struct fields whose names are not observable by reflection and local
+// identifiers are renamed; the result is type-checked before it is returned.
+// Exported identifiers of a library bundle are kept.
+func Minify(src []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, pkg, info, err := typeCheck(fset, src)
+	if err != nil {
+		return nil, fmt.Errorf("type-check bundle: %w", err)
+	}
+
+	m := &minifier{
+		file:       file,
+		pkg:        pkg,
+		info:       info,
+		renames:    make(map[types.Object]string),
+		idents:     make(map[*ast.Ident]string),
+		methods:    make(map[string]string),
+		fields:     make(map[string]string),
+		reserved:   make(map[string]bool),
+		switchVars: make(map[types.Object]bool),
+	}
+	m.classifyTypes(pkg, reflectedTypes([]*ast.File{file}, info))
+	m.collect()
+	m.assignGlobalNames()
+	m.assignLocalNames()
+	m.rename()
+
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, file); err != nil {
+		return nil, err
+	}
+	minified, err := format.Source(removeBlankLines(buf.Bytes()))
+	if err != nil {
+		return nil, err
+	}
+
+	// make sure renaming kept the program valid
+	if _, _, _, err := typeCheck(token.NewFileSet(), minified); err != nil {
+		return nil, fmt.Errorf("minified bundle does not type-check: %w", err)
+	}
+	return minified, nil
+}
+
+func typeCheck(fset *token.FileSet, src []byte) (*ast.File, *types.Package, *types.Info, error) {
+	file, err := parser.ParseFile(fset, "main.go", src, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	info := &types.Info{
+		Types:      make(map[ast.Expr]types.TypeAndValue),
+		Defs:       make(map[*ast.Ident]types.Object),
+		Uses:       make(map[*ast.Ident]types.Object),
+		Implicits:  make(map[ast.Node]types.Object),
+		Selections: make(map[*ast.SelectorExpr]*types.Selection),
+		Instances:  make(map[*ast.Ident]types.Instance),
+	}
+	conf := types.Config{Importer: importer.Default()}
+	pkg, err := conf.Check(file.Name.Name, fset, []*ast.File{file}, info)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return file, pkg, info, nil
+}
+
+type minifier struct {
+	file *ast.File
+	pkg  *types.Package
+	info *types.Info
+
+	// classification of types and fields
+	pinnedTypes   map[*types.TypeName]bool // embedded in structs with observable field names
+	renamedFields map[*types.Var]bool
+	switchVars    map[types.Object]bool // per-clause objects of type switch variables
+
+	// candidates in order of first occurrence, with occurrence counts
+	globals     []types.Object
+	methodNames []string
+	fieldNames  []string
+	counts      map[any]int
+	units       []*localUnit
+
+	renames  map[types.Object]string
+	idents   map[*ast.Ident]string // type switch symbolic variables
+	methods  map[string]string
+	fields   map[string]string
+	reserved map[string]bool
+}
+
+// localUnit holds the local identifiers of a top-level declaration.
+type localUnit struct {
+	objs         []types.Object
+	counts       map[types.Object]int
+	typeSwitches []*ast.TypeSwitchStmt
+}
+
+// objectOf returns the object an identifier refers to, resolving instantiated
+// generic members to their declarations.
+func (m *minifier) objectOf(id *ast.Ident) types.Object {
+	obj := m.info.ObjectOf(id)
+	switch o := obj.(type) {
+	case *types.Var:
+		return o.Origin()
+	case *types.Func:
+		return o.Origin()
+	}
+	return obj
+}
+
+func (m *minifier) isGlobal(obj types.Object) bool {
+	if obj.Pkg() != m.pkg || obj.Parent() != m.pkg.Scope() {
+		return false
+	}
+	switch obj.Name() {
+	case "main", "init", "_":
+		return false
+	}
+	if m.isLibrary() && obj.Exported() {
+		return false
+	}
+	if tn, ok := obj.(*types.TypeName); ok && m.pinnedTypes[tn] {
+		return false
+	}
+	return true
+}
+
+// classifyTypes decides which struct fields are renamed. Fields of
+// package-level struct types are renamed unless their names are observable.
+// Types embedded in such structs keep their names, since renaming them would
+// rename the embedded field.
+func (m *minifier) classifyTypes(pkg *types.Package, observed map[*types.TypeName]bool) {
+	m.pinnedTypes = make(map[*types.TypeName]bool)
+	m.renamedFields = make(map[*types.Var]bool)
+
+	scope := pkg.Scope()
+	for _, name := range scope.Names() {
+		tn, ok := scope.Lookup(name).(*types.TypeName)
+		if !ok {
+			continue
+		}
+		st, ok := tn.Type().Underlying().(*types.Struct)
+		if !ok {
+			continue
+		}
+		for i := 0; i < st.NumFields(); i++ {
+			f := st.Field(i)
+			switch {
+			case observed[tn] && f.Anonymous():
+				if named := namedTypeOf(f.Type()); named != nil {
+					m.pinnedTypes[named.Obj()] = true
+				}
+			case !observed[tn] && !f.Anonymous() && f.Name() != "_":
+				m.renamedFields[f] = true
+			}
+		}
+	}
+}
+
+func (m *minifier) isRenamedMethod(obj types.Object) bool {
+	fn, ok := obj.(*types.Func)
+	if !ok || fn.Pkg() != m.pkg || fn.Exported() || fn.Name() == "_" {
+		return false
+	}
+	return fn.Signature().Recv() != nil
+}
+
+func (m *minifier) isRenamedField(obj types.Object) bool {
+	v, ok := obj.(*types.Var)
+	if !ok || m.isLibrary() && v.Exported() {
+		return false
+	}
+	return m.renamedFields[v]
+}
+
+// isLibrary reports whether the bundle is a library, whose exported names are its API.
+func (m *minifier) isLibrary() bool {
+	return m.pkg.Name() != "main"
+}
+
+// collect gathers rename candidates and the names which must be kept.
+func (m *minifier) collect() {
+	m.counts = make(map[any]int)
+	seen := make(map[any]bool)
+	add := func(key any) bool {
+		m.counts[key]++
+		if seen[key] {
+			return false
+		}
+		seen[key] = true
+		return true
+	}
+
+	for _, name := range types.Universe.Names() {
+		m.reserved[name] = true
+	}
+	m.reserved["main"] = true
+	m.reserved["init"] = true
+
+	for _, decl := range m.file.Decls {
+		unit := &localUnit{counts: make(map[types.Object]int)}
+		m.units = append(m.units, unit)
+
+		ast.Inspect(decl, func(n ast.Node) bool {
+			if ts, ok := n.(*ast.TypeSwitchStmt); ok {
+				if id := typeSwitchVar(ts); id != nil {
+					unit.typeSwitches = append(unit.typeSwitches, ts)
+					for _, clause := range ts.Body.List {
+						if obj := m.info.Implicits[clause]; obj != nil {
+							m.switchVars[obj] = true
+						}
+					}
+				}
+				return true
+			}
+
+			id, ok := n.(*ast.Ident)
+			if !ok {
+				return true
+			}
+			obj := m.objectOf(id)
+			if obj == nil {
+				if !slices.ContainsFunc(unit.typeSwitches, func(ts *ast.TypeSwitchStmt) bool { return typeSwitchVar(ts) == id }) {
+					m.reserved[id.Name] = true
+				}
+				return true
+			}
+			if m.switchVars[obj] {
+				return true
+			}
+
+			switch {
+			case m.isGlobal(obj):
+				if add(obj) {
+					m.globals = append(m.globals, obj)
+				}
+			case m.isRenamedMethod(obj):
+				if add("method " + obj.Name()) {
+					m.methodNames = append(m.methodNames, obj.Name())
+				}
+			case m.isRenamedField(obj):
+				if add("field " + obj.Name()) {
+					m.fieldNames = append(m.fieldNames, obj.Name())
+				}
+			case isLocal(obj):
+				unit.counts[obj]++
+				if unit.counts[obj] == 1 {
+					unit.objs = append(unit.objs, obj)
+				}
+			default:
+				m.reserved[id.Name] = true
+			}
+			return true
+		})
+	}
+	for _, kw := range keywords() {
+		m.reserved[kw] = true
+	}
+}
+
+// isLocal reports whether obj is declared inside a function or type declaration.
+func isLocal(obj types.Object) bool {
+	if obj.Pkg() == nil || obj.Parent() == nil || obj.Name() == "_" {
+		return false
+	}
+	if obj.Parent() == obj.Pkg().Scope() || obj.Parent() == types.Universe {
+		return false
+	}
+	switch o := obj.(type) {
+	case *types.Var:
+		return !o.IsField()
+	case *types.Const, *types.TypeName:
+		return true
+	}
+	return false
+}
+
+type rankedName struct {
+	key   any
+	count int
+	order int
+}
+
+// assignGlobalNames gives the shortest names to the most used package-level
+// identifiers, method names and field names. They share one namespace so
+// that no renamed selector can clash with an embedded field.
+func (m *minifier) assignGlobalNames() {
+	ranked := make([]rankedName, 0, len(m.globals)+len(m.methodNames)+len(m.fieldNames))
+	for _, obj := range m.globals {
+		ranked = append(ranked, rankedName{key: obj, count: m.counts[obj], order: len(ranked)})
+	}
+	for _, name := range m.methodNames {
+		key := "method " + name
+		ranked = append(ranked, rankedName{key: key, count: m.counts[key], order: len(ranked)})
+	}
+	for _, name := range m.fieldNames {
+		key := "field " + name
+		ranked = append(ranked, rankedName{key: key, count: m.counts[key], order: len(ranked)})
+	}
+	slices.SortStableFunc(ranked, func(a, b rankedName) int {
+		return cmp.Or(cmp.Compare(b.count, a.count), cmp.Compare(a.order, b.order))
+	})
+
+	gen := &nameGen{reserved: m.reserved}
+	for _, r := range ranked {
+		name := gen.next()
+		switch key := r.key.(type) {
+		case types.Object:
+			m.renames[key] = name
+		case string:
+			if orig, ok := strings.CutPrefix(key, "method "); ok {
+				m.methods[orig] = name
+			} else if orig, ok := strings.CutPrefix(key, "field "); ok {
+				m.fields[orig] = name
+			}
+		}
+		m.reserved[name] = true
+	}
+}
+
+// assignLocalNames names the locals of each declaration independently. All
+// locals of a declaration get distinct names, so no renamed local can shadow
+// another identifier.
+func (m *minifier) assignLocalNames() {
+	for _, unit := range m.units {
+		objs := slices.Clone(unit.objs)
+		slices.SortStableFunc(objs, func(a, b types.Object) int {
+			return cmp.Compare(unit.counts[b], unit.counts[a])
+		})
+		gen := &nameGen{reserved: m.reserved}
+		for _, obj := range objs {
+			m.renames[obj] = gen.next()
+		}
+
+		// the symbolic variable of a type switch is a distinct object in each clause
+		for _, ts := range unit.typeSwitches {
+			name := gen.next()
+			m.idents[typeSwitchVar(ts)] = name
+			for _, clause := range ts.Body.List {
+				if obj := m.info.Implicits[clause]; obj != nil {
+					m.renames[obj] = name
+				}
+			}
+		}
+	}
+}
+
+// typeSwitchVar returns the symbolic variable declared by "switch x := y.(type)".
+func typeSwitchVar(ts *ast.TypeSwitchStmt) *ast.Ident {
+	assign, ok := ts.Assign.(*ast.AssignStmt)
+	if !ok || len(assign.Lhs) != 1 {
+		return nil
+	}
+	id, ok := assign.Lhs[0].(*ast.Ident)
+	if !ok || id.Name == "_" {
+		return nil
+	}
+	return id
+}
+
+func (m *minifier) rename() {
+	ast.Inspect(m.file, func(n ast.Node) bool {
+		id, ok := n.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		if name, ok := m.idents[id]; ok {
+			id.Name = name
+			return true
+		}
+		obj := m.objectOf(id)
+		if obj == nil {
+			return true
+		}
+		if v, ok := obj.(*types.Var); ok && v.Anonymous() {
+			// embedded field: named after its type
+			if named := namedTypeOf(v.Type()); named != nil {
+				if name, ok := m.renames[named.Obj()]; ok {
+					id.Name = name
+				}
+			}
+			return true
+		}
+		if name, ok := m.renames[obj]; ok {
+			id.Name = name
+		} else if name, ok := m.methods[obj.Name()]; ok && m.isRenamedMethod(obj) {
+			id.Name = name
+		} else if name, ok := m.fields[obj.Name()]; ok && m.isRenamedField(obj) {
+			id.Name = name
+		}
+		return true
+	})
+}
+
+type nameGen struct {
+	n        int
+	reserved map[string]bool
+}
+
+const (
+	nameHead = "abcdefghijklmnopqrstuvwxyz"
+	nameTail = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+)
+
+// next returns the next short identifier that is not reserved. Names start
+// with a lower case letter so renamed methods stay unexported.
+func (g *nameGen) next() string {
+	for {
+		name := shortName(g.n)
+		g.n++
+		if !g.reserved[name] {
+			return name
+		}
+	}
+}
+
+func shortName(n int) string {
+	if n < len(nameHead) {
+		return nameHead[n : n+1]
+	}
+	n -= len(nameHead)
+	length, count := 1, len(nameTail)
+	for n >= len(nameHead)*count {
+		n -= len(nameHead) * count
+		length++
+		count *= len(nameTail)
+	}
+	buf := make([]byte, length+1)
+	for i := length; i > 0; i-- {
+		buf[i] = nameTail[n%len(nameTail)]
+		n /= len(nameTail)
+	}
+	buf[0] = nameHead[n]
+	return string(buf)
+}
+
+func keywords() []string {
+	kws := make([]string, 0, 25)
+	for tok := token.BREAK; tok <= token.VAR; tok++ {
+		if tok.IsKeyword() {
+			kws = append(kws, tok.String())
+		}
+	}
+	return kws
+}
+
+// removeBlankLines drops empty lines outside raw string literals.
+func removeBlankLines(src []byte) []byte {
+	fset := token.NewFileSet()
+	tf := fset.AddFile("", fset.Base(), len(src))
+	var s scanner.Scanner
+	s.Init(tf, src, nil, 0)
+
+	keep := make(map[int]bool)
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok == token.STRING && strings.HasPrefix(lit, "`") {
+			start := tf.Line(pos)
+			for l := start + 1; l <= start+strings.Count(lit, "\n"); l++ {
+				keep[l] = true
+			}
+		}
+	}
+
+	var out bytes.Buffer
+	for i, line := range bytes.SplitAfter(src, []byte{'\n'}) {
+		if len(bytes.TrimSpace(line)) == 0 && !keep[i+1] {
+			continue
+		}
+		out.Write(line)
+	}
+	return out.Bytes()
+}
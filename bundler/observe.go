@@ -0,0 +1,296 @@
+package bundler
+
+import (
+	"go/ast"
+	"go/types"
+)
+
+// reflectedTypes returns the named types whose field names may be observed
+// at run time: values converted to an interface (and so reachable by fmt's
+// %+v, encoding/json and the like), struct types with tags, and struct types
+// converted to each other, which requires identical field names.
+func reflectedTypes(files []*ast.File, info *types.Info) map[*types.TypeName]bool {
+	o := &typeObserver{
+		info:     info,
+		observed: make(map[*types.TypeName]bool),
+		visited:  make(map[types.Type]bool),
+	}
+	for _, f := range files {
+		o.inspect(f)
+	}
+	if o.typeParamEscapes {
+		// a type parameter flowed into an interface: any type argument may be observed
+		for _, inst := range info.Instances {
+			for i := 0; i < inst.TypeArgs.Len(); i++ {
+				o.mark(inst.TypeArgs.At(i))
+			}
+		}
+	}
+	return o.observed
+}
+
+type typeObserver struct {
+	info             *types.Info
+	observed         map[*types.TypeName]bool
+	visited          map[types.Type]bool
+	typeParamEscapes bool
+}
+
+// mark records t and every named type reachable through its structure as observed.
+func (o *typeObserver) mark(t types.Type) {
+	if t == nil || o.visited[t] {
+		return
+	}
+	o.visited[t] = true
+
+	switch tt := t.(type) {
+	case *types.Named:
+		o.observed[tt.Origin().Obj()] = true
+		if args := tt.TypeArgs(); args != nil {
+			for i := 0; i < args.Len(); i++ {
+				o.mark(args.At(i))
+			}
+		}
+		o.mark(tt.Underlying())
+	case *types.Alias:
+		o.mark(types.Unalias(tt))
+	case *types.Pointer:
+		o.mark(tt.Elem())
+	case *types.Slice:
+		o.mark(tt.Elem())
+	case *types.Array:
+		o.mark(tt.Elem())
+	case *types.Map:
+		o.mark(tt.Key())
+		o.mark(tt.Elem())
+	case *types.Chan:
+		o.mark(tt.Elem())
+	case *types.Struct:
+		for i := 0; i < tt.NumFields(); i++ {
+			o.mark(tt.Field(i).Type())
+		}
+	case *types.Tuple:
+		for i := 0; i < tt.Len(); i++ {
+			o.mark(tt.At(i).Type())
+		}
+	case *types.TypeParam:
+		o.typeParamEscapes = true
+	}
+}
+
+// flowType marks src as observed when a value of type src is converted to the interface type dst.
+func (o *typeObserver) flowType(dst, src types.Type) {
+	if dst == nil || src == nil || !types.IsInterface(dst) {
+		return
+	}
+	if tuple, ok := src.(*types.Tuple); ok {
+		o.mark(tuple)
+		return
+	}
+	if types.IsInterface(src) {
+		return
+	}
+	o.mark(src)
+}
+
+func (o *typeObserver) flow(dst types.Type, src ast.Expr) {
+	o.flowType(dst, o.info.TypeOf(src))
+}
+
+// inspect records the types observed in the syntax under root.
+func (o *typeObserver) inspect(root ast.Node) {
+	var stack []ast.Node
+	ast.Inspect(root, func(n ast.Node) bool {
+		if n == nil {
+			stack = stack[:len(stack)-1]
+			return true
+		}
+		stack = append(stack, n)
+
+		switch v := n.(type) {
+		case *ast.TypeSpec:
+			o.inspectTags(v)
+		case *ast.CallExpr:
+			o.inspectCall(v)
+		case *ast.AssignStmt:
+			if len(v.Lhs) == len(v.Rhs) {
+				for i := range v.Lhs {
+					o.flow(o.info.TypeOf(v.Lhs[i]), v.Rhs[i])
+				}
+			} else if len(v.Rhs) == 1 {
+				if tuple, ok := o.info.TypeOf(v.Rhs[0]).(*types.Tuple); ok {
+					for i := range v.Lhs {
+						if i < tuple.Len() {
+							o.flowType(o.info.TypeOf(v.Lhs[i]), tuple.At(i).Type())
+						}
+					}
+				}
+			}
+		case *ast.ValueSpec:
+			if v.Type != nil {
+				dst := o.info.TypeOf(v.Type)
+				for _, value := range v.Values {
+					o.flow(dst, value)
+				}
+			}
+		case *ast.ReturnStmt:
+			if sig := enclosingSignature(o.info, stack); sig != nil && sig.Results().Len() == len(v.Results) {
+				for i, r := range v.Results {
+					o.flow(sig.Results().At(i).Type(), r)
+				}
+			}
+		case *ast.CompositeLit:
+			o.inspectCompositeLit(v)
+		case *ast.SendStmt:
+			if ch, ok := underlying(o.info.TypeOf(v.Chan)).(*types.Chan); ok {
+				o.flow(ch.Elem(), v.Value)
+			}
+		case *ast.IndexExpr:
+			if m, ok := underlying(o.info.TypeOf(v.X)).(*types.Map); ok {
+				o.flow(m.Key(), v.Index)
+			}
+		}
+		return true
+	})
+}
+
+func (o *typeObserver) inspectTags(ts *ast.TypeSpec) {
+	st, ok := ts.Type.(*ast.StructType)
+	if !ok {
+		return
+	}
+	for _, field := range st.Fields.List {
+		if field.Tag != nil {
+			if obj, ok := o.info.Defs[ts.Name].(*types.TypeName); ok {
+				o.observed[obj] = true
+			}
+			return
+		}
+	}
+}
+
+func (o *typeObserver) inspectCall(call *ast.CallExpr) {
+	tv, ok := o.info.Types[call.Fun]
+	if !ok {
+		return
+	}
+
+	// conversion
+	if tv.IsType() {
+		if len(call.Args) != 1 {
+			return
+		}
+		dst, src := tv.Type, o.info.TypeOf(call.Args[0])
+		o.flowType(dst, src)
+		if isStruct(dst) && isStruct(src) {
+			o.mark(dst)
+			o.mark(src)
+		}
+		return
+	}
+
+	sig, ok := underlying(tv.Type).(*types.Signature)
+	if !ok {
+		return
+	}
+	params := sig.Params()
+	if len(call.Args) == 1 && params.Len() > 1 {
+		// f(g()) with multiple results
+		if tuple, ok := o.info.TypeOf(call.Args[0]).(*types.Tuple); ok {
+			for i := 0; i < tuple.Len() && i < params.Len(); i++ {
+				o.flowType(params.At(i).Type(), tuple.At(i).Type())
+			}
+		}
+		return
+	}
+	for i, arg := range call.Args {
+		o.flow(paramType(sig, i, call.Ellipsis.IsValid()), arg)
+	}
+}
+
+func (o *typeObserver) inspectCompositeLit(lit *ast.CompositeLit) {
+	t := underlying(o.info.TypeOf(lit))
+	if p, ok := t.(*types.Pointer); ok {
+		t = underlying(p.Elem())
+	}
+	switch tt := t.(type) {
+	case *types.Struct:
+		for i, elt := range lit.Elts {
+			if kv, ok := elt.(*ast.KeyValueExpr); ok {
+				if key, ok := kv.Key.(*ast.Ident); ok {
+					if field, ok := o.info.Uses[key].(*types.Var); ok {
+						o.flow(field.Type(), kv.Value)
+					}
+				}
+			} else if i < tt.NumFields() {
+				o.flow(tt.Field(i).Type(), elt)
+			}
+		}
+	case *types.Slice, *types.Array:
+		elem := tt.(interface{ Elem() types.Type }).Elem()
+		for _, elt := range lit.Elts {
+			if kv, ok := elt.(*ast.KeyValueExpr); ok {
+				elt = kv.Value
+			}
+			o.flow(elem, elt)
+		}
+	case *types.Map:
+		for _, elt := range lit.Elts {
+			if kv, ok := elt.(*ast.KeyValueExpr); ok {
+				o.flow(tt.Key(), kv.Key)
+				o.flow(tt.Elem(), kv.Value)
+			}
+		}
+	}
+}
+
+// paramType returns the type the i-th argument of a call to sig is assigned to.
+func paramType(sig *types.Signature, i int, hasEllipsis bool) types.Type {
+	params := sig.Params()
+	if params.Len() == 0 {
+		return nil
+	}
+	if sig.Variadic() && i >= params.Len()-1 {
+		last := params.At(params.Len() - 1).Type()
+		if hasEllipsis {
+			return last
+		}
+		if s, ok := underlying(last).(*types.Slice); ok {
+			return s.Elem()
+		}
+		return nil
+	}
+	if i >= params.Len() {
+		return nil
+	}
+	return params.At(i).Type()
+}
+
+// enclosingSignature returns the signature of the innermost function in stack.
+func enclosingSignature(info *types.Info, stack []ast.Node) *types.Signature {
+	for i := len(stack) - 1; i >= 0; i-- {
+		switch fn := stack[i].(type) {
+		case *ast.FuncLit:
+			sig, _ := info.TypeOf(fn).(*types.Signature)
+			return sig
+		case *ast.FuncDecl:
+			if obj, ok := info.Defs[fn.Name].(*types.Func); ok {
+				return obj.Signature()
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+func underlying(t types.Type) types.Type {
+	if t == nil {
+		return nil
+	}
+	return t.Underlying()
+}
+
+func isStruct(t types.Type) bool {
+	_, ok := underlying(t).(*types.Struct)
+	return ok
+}
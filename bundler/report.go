@@ -0,0 +1,149 @@
+package bundler
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"time"
+)
+
+// Report is a machine-readable summary of a bundle run.
+type Report struct {
+	// GoVersion is the version of the go command that loaded the packages.
+	GoVersion string `json:"go_version"`
+	// ModuleGoVersion is the go directive of the module of the target package.
+	ModuleGoVersion string `json:"module_go_version,omitempty"`
+	// Packages lists the bundled packages in dependency order.
+	Packages []PackageReport `json:"packages"`
+	// Kept and Dropped list the package-level declarations that tree
+	// shaking kept and removed; Dropped also has pruned struct fields.
+	Kept    []DeclReport `json:"kept"`
+	Dropped []DeclReport `json:"dropped"`
+	// OriginalLines and OriginalBytes measure the source files of the
+	// bundled packages, BundledLines and BundledBytes the formatted bundle
+	// without its header.
+	OriginalLines int `json:"original_lines"`
+	BundledLines  int `json:"bundled_lines"`
+	OriginalBytes int `json:"original_bytes"`
+	BundledBytes  int `json:"bundled_bytes"`
+	// Timings lists the phases of the run in order.
+	Timings []PhaseTiming `json:"timings"`
+	// Warnings describes problems that did not stop the bundle.
+	Warnings []string `json:"warnings"`
+}
+
+// PackageReport describes a bundled package.
+type PackageReport struct {
+	Path string `json:"path"` // import path
+	Name string `json:"name"`
+	// Prefix is prepended to the package-level names of the package in the
+	// bundle; it is empty for names that are kept as they are.
+	Prefix string `json:"prefix"`
+	// Files are the compiled Go files of the package, relative to
+	// Options.FS when the package was loaded from it.
+	Files []string `json:"files"`
+}
+
+// DeclReport describes a package-level declaration or a struct field.
+type DeclReport struct {
+	Package string `json:"package"` // import path
+	// Name is the declared name, "Type.Method" for a method or
+	// "Type.Field" for a field.
+	Name string `json:"name"`
+	// Kind is func, method, type, var, const or field.
+	Kind string `json:"kind"`
+	// Pos is the position of the name as importpath/file.go:line:column.
+	Pos string `json:"pos"`
+	// Bytes is the printed size of a kept declaration. Declarations
+	// sharing a spec or a const block split its size evenly.
+	Bytes int `json:"bytes,omitempty"`
+}
+
+// PhaseTiming is the wall time of a phase of the run, such as load,
+// analyze or format.
+type PhaseTiming struct {
+	Phase      string  `json:"phase"`
+	DurationMS float64 `json:"duration_ms"`
+}
+
+func newReport() *Report {
+	return &Report{
+		GoVersion: goVersion(),
+		Packages:  make([]PackageReport, 0),
+		Kept:      make([]DeclReport, 0),
+		Dropped:   make([]DeclReport, 0),
+		Timings:   make([]PhaseTiming, 0),
+		Warnings:  make([]string, 0),
+	}
+}
+
+func newPhaseTiming(phase string, d time.Duration) PhaseTiming {
+	return PhaseTiming{
+		Phase:      phase,
+		DurationMS: float64(d.Microseconds()) / 1000,
+	}
+}
+
+func (r *Report) addTiming(phase string, d time.Duration) {
+	r.Timings = append(r.Timings, newPhaseTiming(phase, d))
+}
+
+func (r *Report) warnf(format string, args ...any) {
+	r.Warnings = append(r.Warnings, fmt.Sprintf(format, args...))
+}
+
+// LargestDecls returns the n largest kept declarations by printed size.
+func (r *Report) LargestDecls(n int) []DeclReport {
+	decls := slices.Clone(r.Kept)
+	slices.SortStableFunc(decls, func(a, b DeclReport) int {
+		return cmp.Compare(b.Bytes, a.Bytes)
+	})
+	return decls[:min(n, len(decls))]
+}
+
+// PackageSize is the size of the kept declarations of a package.
+type PackageSize struct {
+	Path  string // import path
+	Bytes int    // sum of DeclReport.Bytes
+}
+
+// LargestPackages returns the n packages contributing the most bytes of kept declarations.
+func (r *Report) LargestPackages(n int) []PackageSize {
+	sizes := make([]PackageSize, 0, len(r.Packages))
+	for _, p := range r.Packages {
+		total := 0
+		for _, d := range r.Kept {
+			if d.Package == p.Path {
+				total += d.Bytes
+			}
+		}
+		sizes = append(sizes, PackageSize{Path: p.Path, Bytes: total})
+	}
+	slices.SortStableFunc(sizes, func(a, b PackageSize) int {
+		return cmp.Compare(b.Bytes, a.Bytes)
+	})
+	return sizes[:min(n, len(sizes))]
+}
+
+// Write writes the report to w as indented JSON.
+func (r *Report) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteFile writes the report to the file at path as indented JSON.
+func (r *Report) WriteFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := r.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
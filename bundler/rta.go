@@ -0,0 +1,492 @@
+package bundler
+
+import (
+	"cmp"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"slices"
+	"strings"
+
+	"golang.org/x/tools/go/callgraph/rta"
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/ssa/ssautil"
+)
+
+const (
+	// keepDirective forces a declaration into the bundle.
+	keepDirective = "//bundler:keep"
+	// dropDirective removes a declaration from the bundle.
+	dropDirective = "//bundler:drop"
+)
+
+// Shake selects how the declarations to bundle are found.
+type Shake string
+
+const (
+	// ShakeRTA builds SSA for the whole program and runs RTA from main and
+	// init, so only methods RTA finds are called.
+	ShakeRTA Shake = "rta"
+	// ShakeSyntactic follows the identifiers used by declarations from main
+	// and init without building SSA. Every method of a reachable type is
+	// bundled and considered called.
+	ShakeSyntactic Shake = "syntactic"
+	// ShakeNone bundles every declaration of the non-std packages.
+	ShakeNone Shake = "none"
+)
+
+func ParseShake(s string) (Shake, error) {
+	switch sh := Shake(s); sh {
+	case ShakeRTA, ShakeSyntactic, ShakeNone:
+		return sh, nil
+	}
+	return "", fmt.Errorf("unknown shake mode %q (available: %s, %s, %s)", s, ShakeRTA, ShakeSyntactic, ShakeNone)
+}
+
+// analyzeReachableDecls returns the declarations to bundle and the functions
+// and methods that may actually be called at run time. Every method of a
+// reachable type is bundled, but with ShakeRTA only those found by RTA are
+// called. Besides main and init, roots are the objects selected with
+// Options.Roots or the API of a library bundle.
+func analyzeReachableDecls(main *packages.Package, topoPkg []*packages.Package, roots []types.Object, shake Shake) (map[types.Object]bool, map[types.Object]bool, error) {
+	if shake == "" {
+		shake = ShakeRTA
+	}
+	a := &reachabilityAnalyzer{
+		mainPkg:     main,
+		topoPkgs:    topoPkg,
+		roots:       roots,
+		shake:       shake,
+		reachableFn: make(map[*ssa.Function]bool, 128),
+		dropped:     make(map[types.Object]bool),
+	}
+	if shake == ShakeRTA {
+		a.buildSSA()
+		a.analyzeRTA()
+	}
+	if err := a.buildDeclGraph(); err != nil {
+		return nil, nil, err
+	}
+	a.propagateDeclReachability()
+	if err := a.checkDropped(); err != nil {
+		return nil, nil, err
+	}
+	return a.reachableDecls, a.calledFuncs(), nil
+}
+
+type reachabilityAnalyzer struct {
+	// input
+	mainPkg  *packages.Package
+	topoPkgs []*packages.Package
+	roots    []types.Object
+	shake    Shake
+
+	// cache
+	prog        *ssa.Program
+	ssaPkgs     []*ssa.Package
+	reachableFn map[*ssa.Function]bool
+	declGraph   map[types.Object][]types.Object
+	decls       []types.Object // every declaration, methods included
+	inits       []types.Object // init functions
+	kept        []types.Object
+	dropped     map[types.Object]bool
+
+	// output
+	reachableDecls map[types.Object]bool
+}
+
+func (a *reachabilityAnalyzer) buildSSA() {
+	prog, ssaPkgs := ssautil.AllPackages([]*packages.Package{a.mainPkg}, ssa.InstantiateGenerics)
+	prog.Build()
+
+	a.prog = prog
+	a.ssaPkgs = ssaPkgs
+}
+
+// analyzeRTA finds the functions that may be called at run time. std
+// functions are loaded without bodies, so RTA cannot see what they call
+// back: function values and methods of values that reachable code hands
+// over to them are added as roots until no new one is found.
+func (a *reachabilityAnalyzer) analyzeRTA() {
+	roots := append(rootsPkgs(a.ssaPkgs), a.rootFuncs()...)
+	if len(roots) == 0 {
+		return
+	}
+	seen := make(map[*ssa.Function]bool, len(roots))
+	for _, f := range roots {
+		seen[f] = true
+	}
+	for {
+		res := rta.Analyze(roots, false)
+		if res == nil {
+			panic("res is nil")
+		}
+		n := len(roots)
+		for f := range res.Reachable {
+			a.reachableFn[f] = true
+			for _, g := range escapingFuncs(f) {
+				if !seen[g] {
+					seen[g] = true
+					roots = append(roots, g)
+				}
+			}
+		}
+		for _, t := range res.RuntimeTypes.Keys() {
+			mset := a.prog.MethodSets.MethodSet(t)
+			for i := 0; i < mset.Len(); i++ {
+				if g := a.prog.MethodValue(mset.At(i)); g != nil && !seen[g] {
+					seen[g] = true
+					roots = append(roots, g)
+				}
+			}
+		}
+		if len(roots) == n {
+			return
+		}
+	}
+}
+
+// escapingFuncs returns the functions that f uses as values rather than calls.
+func escapingFuncs(f *ssa.Function) []*ssa.Function {
+	var ret []*ssa.Function
+	var ops []*ssa.Value
+	for _, b := range f.Blocks {
+		for _, instr := range b.Instrs {
+			var callee *ssa.Value
+			if call, ok := instr.(ssa.CallInstruction); ok {
+				callee = &call.Common().Value
+			}
+			for _, op := range instr.Operands(ops[:0]) {
+				if g, ok := (*op).(*ssa.Function); ok && op != callee && g.Blocks != nil {
+					ret = append(ret, g)
+				}
+			}
+		}
+	}
+	return ret
+}
+
+func (a *reachabilityAnalyzer) buildDeclGraph() error {
+	a.declGraph = make(map[types.Object][]types.Object, 128)
+	// declare records obj and its directives
+	declare := func(obj types.Object, docs ...*ast.CommentGroup) error {
+		a.decls = append(a.decls, obj)
+		for _, doc := range docs {
+			keep, drop := hasDirective(doc, keepDirective), hasDirective(doc, dropDirective)
+			if !keep && !drop {
+				continue
+			}
+			pos := a.mainPkg.Fset.Position(obj.Pos())
+			if keep && drop {
+				return fmt.Errorf("%s: %s has both %s and %s", pos, obj.Name(), keepDirective, dropDirective)
+			}
+			if keep {
+				a.kept = append(a.kept, obj)
+			} else {
+				a.dropped[obj] = true
+			}
+		}
+		return nil
+	}
+
+	for _, p := range a.topoPkgs {
+		info := p.TypesInfo
+		if info == nil {
+			continue
+		}
+
+		for _, f := range p.Syntax {
+			for _, decl := range f.Decls {
+				switch d := decl.(type) {
+				case *ast.FuncDecl:
+					obj := info.Defs[d.Name]
+					if obj != nil {
+						if err := declare(obj, d.Doc); err != nil {
+							return err
+						}
+						if d.Recv == nil && d.Name.Name == "init" {
+							a.inits = append(a.inits, obj)
+						}
+						a.inspectDeclBody(info, []types.Object{obj}, d)
+					}
+				case *ast.GenDecl:
+					switch d.Tok {
+					case token.TYPE:
+						for _, spec := range d.Specs {
+							if ts, ok := spec.(*ast.TypeSpec); ok {
+								if obj := info.Defs[ts.Name]; obj != nil {
+									if err := declare(obj, d.Doc, ts.Doc); err != nil {
+										return err
+									}
+									a.inspectDeclBody(info, []types.Object{obj}, d)
+								}
+							}
+						}
+					case token.VAR, token.CONST:
+						var last *ast.ValueSpec // spec repeated by implicit const specs
+						for _, spec := range d.Specs {
+							if vs, ok := spec.(*ast.ValueSpec); ok {
+								var curDecls []types.Object
+								for _, name := range vs.Names {
+									if obj := info.Defs[name]; obj != nil {
+										if err := declare(obj, d.Doc, vs.Doc); err != nil {
+											return err
+										}
+										curDecls = append(curDecls, obj)
+									}
+								}
+								if len(vs.Values) > 0 {
+									last = vs
+								}
+								if d.Tok == token.CONST && last != nil && len(last.Values) == len(vs.Names) && len(curDecls) == len(vs.Names) {
+									// each constant depends only on its own value
+									for i, obj := range curDecls {
+										if last.Type != nil {
+											a.inspectDeclBody(info, curDecls[i:i+1], last.Type)
+										}
+										a.inspectDeclBody(info, []types.Object{obj}, last.Values[i])
+									}
+								} else if len(curDecls) > 0 {
+									a.inspectDeclBody(info, curDecls, vs)
+								}
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// hasDirective reports whether the comment group contains the directive line.
+func hasDirective(doc *ast.CommentGroup, directive string) bool {
+	if doc == nil {
+		return false
+	}
+	for _, c := range doc.List {
+		if strings.TrimSpace(c.Text) == directive {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *reachabilityAnalyzer) inspectDeclBody(info *types.Info, parents []types.Object, root ast.Node) {
+	ast.Inspect(root, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok {
+			if obj := info.Uses[id]; obj != nil {
+				for _, p := range parents {
+					a.declGraph[p] = append(a.declGraph[p], obj)
+				}
+			}
+		}
+		return true
+	})
+}
+
+func (a *reachabilityAnalyzer) propagateDeclReachability() {
+	a.reachableDecls = make(map[types.Object]bool, len(a.reachableFn))
+	queue := make([]types.Object, 0, len(a.reachableFn))
+	for f := range a.reachableFn {
+		if obj := f.Object(); obj != nil {
+			if f.Pkg != nil && !isStd(pkgPath(f.Pkg.Pkg.Path())) {
+				queue = append(queue, obj)
+			}
+		}
+	}
+	queue = append(queue, a.kept...)
+	queue = append(queue, a.roots...)
+	switch a.shake {
+	case ShakeSyntactic:
+		queue = append(queue, a.inits...)
+		if a.mainPkg.Name == "main" {
+			if obj := a.mainPkg.Types.Scope().Lookup("main"); obj != nil {
+				queue = append(queue, obj)
+			}
+		}
+	case ShakeNone:
+		queue = append(queue, a.decls...)
+	}
+
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		if a.reachableDecls[cur] || a.dropped[cur] {
+			continue
+		}
+		a.reachableDecls[cur] = true
+
+		if tn, ok := cur.(*types.TypeName); ok {
+			for _, m := range methodOfType(tn) {
+				if !a.reachableDecls[m] {
+					queue = append(queue, m)
+				}
+			}
+		}
+
+		for _, next := range a.declGraph[cur] {
+			if !a.reachableDecls[next] {
+				queue = append(queue, next)
+			}
+		}
+	}
+}
+
+// calledFuncs returns the source objects of the functions found by RTA.
+// Instantiations of generic functions map to their generic declaration.
+// Without RTA, every reachable function may be called.
+func (a *reachabilityAnalyzer) calledFuncs() map[types.Object]bool {
+	called := make(map[types.Object]bool, len(a.reachableFn))
+	if a.shake != ShakeRTA {
+		for obj := range a.reachableDecls {
+			if fn, ok := obj.(*types.Func); ok {
+				called[fn] = true
+			}
+		}
+		return called
+	}
+	for f := range a.reachableFn {
+		if fn, ok := f.Object().(*types.Func); ok {
+			called[fn.Origin()] = true
+		}
+	}
+	return called
+}
+
+// checkDropped reports an error when a reachable declaration still refers to a dropped one.
+func (a *reachabilityAnalyzer) checkDropped() error {
+	referrers := make([]types.Object, 0, len(a.reachableDecls))
+	for obj := range a.reachableDecls {
+		referrers = append(referrers, obj)
+	}
+	slices.SortFunc(referrers, func(x, y types.Object) int {
+		return cmp.Compare(x.Pos(), y.Pos())
+	})
+
+	for _, obj := range referrers {
+		for _, next := range a.declGraph[obj] {
+			if a.dropped[next] {
+				return fmt.Errorf("%s: %s is marked %s but referenced by %s at %s",
+					a.mainPkg.Fset.Position(next.Pos()), next.Name(), dropDirective,
+					obj.Name(), a.mainPkg.Fset.Position(obj.Pos()))
+			}
+		}
+	}
+
+	// a method is not referenced by name when it satisfies an interface
+	dropped := make([]types.Object, 0, len(a.dropped))
+	for obj := range a.dropped {
+		dropped = append(dropped, obj)
+	}
+	slices.SortFunc(dropped, func(x, y types.Object) int {
+		return cmp.Compare(x.Pos(), y.Pos())
+	})
+	called := a.calledFuncs()
+	for _, obj := range dropped {
+		fn, ok := obj.(*types.Func)
+		if !ok || fn.Signature().Recv() == nil {
+			continue
+		}
+		recv := receiverTypeName(fn)
+		if recv == nil {
+			continue
+		}
+		// without RTA, every method of a kept type may be called
+		if a.shake == ShakeRTA && called[fn] || a.shake != ShakeRTA && a.reachableDecls[recv] {
+			return fmt.Errorf("%s: %s.%s is marked %s but may be called through an interface",
+				a.mainPkg.Fset.Position(fn.Pos()), recv.Name(), fn.Name(), dropDirective)
+		}
+	}
+	return nil
+}
+
+// receiverTypeName returns the declared type of the receiver of method fn.
+func receiverTypeName(fn *types.Func) *types.TypeName {
+	t := fn.Signature().Recv().Type()
+	if ptr, ok := t.(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+	if named, ok := t.(*types.Named); ok {
+		return named.Origin().Obj()
+	}
+	return nil
+}
+
+func methodOfType(tn *types.TypeName) []types.Object {
+	named, ok := tn.Type().(*types.Named)
+	if !ok {
+		return nil
+	}
+	if named.Obj().Pkg() == nil {
+		return nil
+	}
+	ret := make([]types.Object, 0, named.NumMethods())
+	for i := 0; i < named.NumMethods(); i++ {
+		ret = append(ret, named.Method(i))
+	}
+	return ret
+}
+
+// rootFuncs returns the SSA functions of the extra roots: the init of the
+// target package of a library, root functions and methods, and the methods
+// of root types. Generic functions and types have no SSA code of their own
+// and are reached through the declaration graph only.
+func (a *reachabilityAnalyzer) rootFuncs() []*ssa.Function {
+	if len(a.roots) == 0 {
+		return nil
+	}
+	var funcs []*ssa.Function
+	if p := a.prog.Package(a.mainPkg.Types); p != nil && a.mainPkg.Name != "main" {
+		if f := p.Func("init"); f != nil {
+			funcs = append(funcs, f)
+		}
+	}
+	for _, obj := range a.roots {
+		switch o := obj.(type) {
+		case *types.Func:
+			sig := o.Signature()
+			if sig.TypeParams().Len() == 0 && sig.RecvTypeParams().Len() == 0 && !isInterfaceMethod(sig) {
+				if f := a.prog.FuncValue(o); f != nil {
+					funcs = append(funcs, f)
+				}
+			}
+		case *types.TypeName:
+			named, ok := o.Type().(*types.Named)
+			if !ok || named.TypeParams().Len() > 0 || types.IsInterface(named) {
+				continue
+			}
+			for _, t := range []types.Type{named, types.NewPointer(named)} {
+				mset := a.prog.MethodSets.MethodSet(t)
+				for i := 0; i < mset.Len(); i++ {
+					if f := a.prog.MethodValue(mset.At(i)); f != nil {
+						funcs = append(funcs, f)
+					}
+				}
+			}
+		}
+	}
+	return funcs
+}
+
+func isInterfaceMethod(sig *types.Signature) bool {
+	return sig.Recv() != nil && types.IsInterface(sig.Recv().Type())
+}
+
+func rootsPkgs(pkgs []*ssa.Package) []*ssa.Function {
+	roots := make([]*ssa.Function, 0, 2)
+	for _, p := range pkgs {
+		if p == nil || p.Pkg.Name() != "main" {
+			continue
+		}
+		if f := p.Func("init"); f != nil {
+			roots = append(roots, f)
+		}
+		if f := p.Func("main"); f != nil {
+			roots = append(roots, f)
+		}
+	}
+	return roots
+}
@@ -0,0 +1,173 @@
+package bundler
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/imports"
+)
+
+// Result is a bundled package.
+type Result struct {
+	// Source is the bundled file, with its header unless Options.Snippet is set.
+	Source []byte
+	// Report describes the bundle. It is set whenever the packages could be
+	// bundled, even if a later step such as the size check failed.
+	Report *Report
+	// Diagnostics lists the errors of the loaded packages. Bundling fails
+	// with most of them, but not with errors in unreachable code.
+	Diagnostics []Diagnostic
+}
+
+// Diagnostic is an error reported while loading a package.
+type Diagnostic struct {
+	Package string `json:"package"`
+	Pos     string `json:"pos,omitempty"` // file:line:col, if known
+	Kind    string `json:"kind"`          // list, parse or type
+	Message string `json:"message"`
+}
+
+func (d Diagnostic) String() string {
+	if d.Pos != "" {
+		return d.Pos + ": " + d.Message
+	}
+	return d.Package + ": " + d.Message
+}
+
+// Run loads the packages selected by opts and bundles the target package.
+// The result is returned whenever the packages were loaded, so that its
+// diagnostics can explain a failure.
+func Run(opts Options) (*Result, error) {
+	start := time.Now()
+	pkgs, err := Load(opts)
+	if err != nil {
+		return nil, fmt.Errorf("load packages: %w", err)
+	}
+	if len(pkgs) != 1 {
+		return nil, fmt.Errorf("%s matched %d packages", strings.Join(opts.Patterns, " "), len(pkgs))
+	}
+	return render(pkgs, opts, time.Since(start))
+}
+
+// Bundle bundles the target package of pkgs, which are usually loaded by
+// Load: the first main package, or the first package with Options.Library.
+// Dir, Patterns, Overlay and FS are not used. pkgs are not modified, so several
+// bundles of the same packages may be made at once.
+func Bundle(pkgs []*packages.Package, opts Options) (*Result, error) {
+	return render(clonePackages(pkgs), opts, 0)
+}
+
+// render bundles pkgs, rewriting their syntax trees, and formats the result.
+func render(pkgs []*packages.Package, opts Options, loadTime time.Duration) (*Result, error) {
+	res := &Result{Diagnostics: diagnostics(pkgs)}
+
+	// bundle into a single source file
+	var raw bytes.Buffer
+	report, err := generate(pkgs, &raw, opts)
+	if err != nil {
+		// errors of the packages are usually the cause
+		if len(res.Diagnostics) > 0 {
+			return res, fmt.Errorf("bundle: %w (%v)", err, res.Diagnostics[0])
+		}
+		return res, fmt.Errorf("bundle: %w", err)
+	}
+	res.Report = report
+
+	// format bundled source file with goimports
+	start := time.Now()
+	formatted, err := goimports(raw.Bytes())
+	if err != nil {
+		return res, fmt.Errorf("goimports: %w", err)
+	}
+	report.addTiming("format", time.Since(start))
+
+	if opts.Minify {
+		start = time.Now()
+		formatted, err = Minify(formatted)
+		if err != nil {
+			return res, fmt.Errorf("minify: %w", err)
+		}
+		report.addTiming("minify", time.Since(start))
+	}
+	for _, hook := range opts.OutputHooks {
+		if formatted, err = hook(formatted); err != nil {
+			return res, fmt.Errorf("output hook: %w", err)
+		}
+	}
+	if loadTime > 0 {
+		report.Timings = append([]PhaseTiming{newPhaseTiming("load", loadTime)}, report.Timings...)
+	}
+	report.BundledLines = bytes.Count(formatted, []byte{'\n'})
+	report.BundledBytes = len(formatted)
+
+	// build output
+	var out bytes.Buffer
+	if opts.Snippet {
+		out.Write(stripPackageClause(formatted))
+	} else {
+		g := newMetricGenerator(report.OriginalLines, report.BundledLines)
+		g.writeHeader(&out)
+		if opts.WithMetrics {
+			g.writeMetrics(&out)
+		}
+		if opts.WithSustainabilityMetrics {
+			g.writeSustainabilityMetrics(&out)
+		}
+		g.writeProjectURL(&out)
+		out.Write(formatted)
+	}
+
+	if err := checkSize(int64(out.Len()), opts.MaxSize, report); err != nil {
+		return res, err
+	}
+	res.Source = out.Bytes()
+	return res, nil
+}
+
+// diagnostics returns the errors of the import graph of pkgs.
+func diagnostics(pkgs []*packages.Package) []Diagnostic {
+	var ret []Diagnostic
+	packages.Visit(pkgs, nil, func(p *packages.Package) {
+		for _, e := range p.Errors {
+			ret = append(ret, Diagnostic{
+				Package: p.PkgPath,
+				Pos:     e.Pos,
+				Kind:    errorKind(e.Kind),
+				Message: e.Msg,
+			})
+		}
+	})
+	return ret
+}
+
+func errorKind(k packages.ErrorKind) string {
+	switch k {
+	case packages.ListError:
+		return "list"
+	case packages.ParseError:
+		return "parse"
+	case packages.TypeError:
+		return "type"
+	}
+	return "unknown"
+}
+
+// goimports formats src and removes unused imports.
+func goimports(src []byte) ([]byte, error) {
+	return imports.Process("main.go", src, &imports.Options{
+		Comments:  true,
+		TabIndent: true,
+		TabWidth:  4,
+	})
+}
+
+// stripPackageClause removes the package clause and the blank lines after it.
+func stripPackageClause(src []byte) []byte {
+	if _, rest, ok := bytes.Cut(src, []byte("\n")); ok && bytes.HasPrefix(src, []byte("package ")) {
+		return bytes.TrimLeft(rest, "\n")
+	}
+	return src
+}
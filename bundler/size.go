@@ -0,0 +1,26 @@
+package bundler
+
+import (
+	"fmt"
+	"strings"
+)
+
+// checkSize returns an error describing what to cut when size exceeds maxSize.
+// A maxSize of 0 disables the check.
+func checkSize(size, maxSize int64, report *Report) error {
+	if maxSize <= 0 || size <= maxSize {
+		return nil
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "bundle is %d bytes, exceeds max size %d bytes by %d\n", size, maxSize, size-maxSize)
+	fmt.Fprintln(&sb, "largest declarations:")
+	for _, d := range report.LargestDecls(10) {
+		fmt.Fprintf(&sb, "  %8d  %s %s (%s)\n", d.Bytes, d.Kind, d.Name, d.Package)
+	}
+	fmt.Fprintln(&sb, "largest packages:")
+	for _, p := range report.LargestPackages(5) {
+		fmt.Fprintf(&sb, "  %8d  %s\n", p.Bytes, p.Path)
+	}
+	return fmt.Errorf("%s", strings.TrimRight(sb.String(), "\n"))
+}
@@ -0,0 +1,152 @@
+package bundler
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strconv"
+)
+
+// pruneConstDecl returns decl with only the reachable constants.
+//
+// Specs before the first removed constant are kept as written. Every kept
+// spec after it is made explicit: an implicit repetition gets the type and
+// values of the spec it repeats, and iota is replaced with the constant's
+// original index, so each constant keeps its value.
+func pruneConstDecl(info *types.Info, decl *ast.GenDecl, reachable map[types.Object]bool) *ast.GenDecl {
+	specs := make([]ast.Spec, 0, len(decl.Specs))
+	intact := true
+	var typ ast.Expr
+	var values []ast.Expr
+	for i, spec := range decl.Specs {
+		vs, ok := spec.(*ast.ValueSpec)
+		if !ok {
+			continue
+		}
+		if len(vs.Values) > 0 {
+			typ, values = vs.Type, vs.Values
+		}
+
+		keep := make([]int, 0, len(vs.Names))
+		for j, name := range vs.Names {
+			if reachable[info.Defs[name]] {
+				keep = append(keep, j)
+			}
+		}
+		if intact && len(keep) == len(vs.Names) {
+			specs = append(specs, vs)
+			continue
+		}
+		intact = false
+		if len(keep) == 0 {
+			continue
+		}
+
+		pruned := *vs
+		pruned.Type = typ
+		pruned.Names = make([]*ast.Ident, 0, len(keep))
+		pruned.Values = make([]ast.Expr, 0, len(keep))
+		for _, j := range keep {
+			pruned.Names = append(pruned.Names, vs.Names[j])
+			if j < len(values) {
+				pruned.Values = append(pruned.Values, replaceIota(info, values[j], i))
+			}
+		}
+		specs = append(specs, &pruned)
+	}
+	if intact {
+		return decl
+	}
+
+	d := *decl
+	d.Specs = specs
+	if len(specs) == 1 {
+		d.Lparen, d.Rparen = token.NoPos, token.NoPos
+	}
+	return &d
+}
+
+// replaceIota returns a copy of the constant expression x with iota replaced by n.
+// Subexpressions without iota are shared with x.
+func replaceIota(info *types.Info, x ast.Expr, n int) ast.Expr {
+	switch v := x.(type) {
+	case *ast.Ident:
+		if info.Uses[v] == types.Universe.Lookup("iota") {
+			return &ast.BasicLit{ValuePos: v.Pos(), Kind: token.INT, Value: strconv.Itoa(n)}
+		}
+	case *ast.ParenExpr:
+		c := *v
+		c.X = replaceIota(info, v.X, n)
+		return &c
+	case *ast.UnaryExpr:
+		c := *v
+		c.X = replaceIota(info, v.X, n)
+		return &c
+	case *ast.BinaryExpr:
+		c := *v
+		c.X = replaceIota(info, v.X, n)
+		c.Y = replaceIota(info, v.Y, n)
+		return &c
+	case *ast.CallExpr:
+		c := *v
+		c.Args = make([]ast.Expr, len(v.Args))
+		for i, arg := range v.Args {
+			c.Args[i] = replaceIota(info, arg, n)
+		}
+		return &c
+	}
+	return x
+}
+
+// pruneVarSpec returns spec with only the reachable variables. An unreachable
+// variable whose value may have side effects, or that is assigned from a call
+// returning several values, is renamed to _ so the value is still evaluated.
+func pruneVarSpec(info *types.Info, spec *ast.ValueSpec, reachable map[types.Object]bool) *ast.ValueSpec {
+	all := true
+	for _, name := range spec.Names {
+		if !reachable[info.Defs[name]] {
+			all = false
+		}
+	}
+	if all {
+		return spec
+	}
+
+	pruned := *spec
+	pruned.Names = make([]*ast.Ident, 0, len(spec.Names))
+	pruned.Values = nil
+	tuple := len(spec.Values) > 0 && len(spec.Values) != len(spec.Names)
+	if tuple {
+		pruned.Values = spec.Values
+	}
+	for i, name := range spec.Names {
+		switch {
+		case reachable[info.Defs[name]]:
+			pruned.Names = append(pruned.Names, name)
+		case tuple || (i < len(spec.Values) && !isPure(info, spec.Values[i])):
+			pruned.Names = append(pruned.Names, &ast.Ident{NamePos: name.NamePos, Name: "_"})
+		default:
+			continue
+		}
+		if !tuple && i < len(spec.Values) {
+			pruned.Values = append(pruned.Values, spec.Values[i])
+		}
+	}
+	return &pruned
+}
+
+// isPure reports whether evaluating x has no side effects.
+func isPure(info *types.Info, x ast.Expr) bool {
+	if tv, ok := info.Types[x]; ok && tv.Value != nil {
+		return true
+	}
+	switch v := x.(type) {
+	case *ast.FuncLit, *ast.BasicLit:
+		return true
+	case *ast.Ident:
+		return true
+	case *ast.ParenExpr:
+		return isPure(info, v.X)
+	}
+	return false
+}
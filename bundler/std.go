@@ -0,0 +1,181 @@
+package bundler
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"go/build"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/Atnuhs/go-bundler/internal/atomicfile"
+	"github.com/Atnuhs/go-bundler/internal/cachedir"
+	"golang.org/x/tools/go/packages"
+)
+
+// std holds the std packages of the go command in use. They are listed on
+// first use and cached on disk, keyed by the Go environment. When they
+// cannot be listed, packages are looked up in GOROOT instead.
+var std struct {
+	once sync.Once
+	set  map[pkgPath]bool
+	env  goEnv
+	err  error
+
+	mu    sync.Mutex
+	found map[pkgPath]bool // results of the GOROOT fallback
+}
+
+// stdPackages returns the std package set, or the error that prevented
+// listing it.
+func stdPackages() (map[pkgPath]bool, error) {
+	std.once.Do(func() {
+		std.set, std.env, std.err = loadStdSet()
+	})
+	return std.set, std.err
+}
+
+// goVersion returns the version of the go command in use, or "" when go env
+// failed.
+func goVersion() string {
+	stdPackages()
+	return std.env.GOVERSION
+}
+
+func isStd(pp pkgPath) bool {
+	if set, err := stdPackages(); err == nil {
+		return set[pp]
+	}
+	return inGoroot(pp)
+}
+
+// inGoroot reports whether GOROOT/src has a directory for pp, which is how
+// go/build tells std packages apart.
+func inGoroot(pp pkgPath) bool {
+	std.mu.Lock()
+	defer std.mu.Unlock()
+	if ok, found := std.found[pp]; found {
+		return ok
+	}
+	goroot := std.env.GOROOT
+	if goroot == "" {
+		goroot = build.Default.GOROOT
+	}
+	fi, err := os.Stat(filepath.Join(goroot, "src", filepath.FromSlash(string(pp))))
+	ok := pp != "" && err == nil && fi.IsDir()
+	if std.found == nil {
+		std.found = make(map[pkgPath]bool)
+	}
+	std.found[pp] = ok
+	return ok
+}
+
+// goEnv is the output of go env -json. Besides the installation, the std
+// packages listed depend on the target and build tags: a package is left
+// out when no file of it is built.
+type goEnv struct {
+	GOROOT    string
+	GOVERSION string
+	GOOS      string
+	GOARCH    string
+	GOFLAGS   string
+}
+
+func readGoEnv() (goEnv, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("go", "env", "-json", "GOROOT", "GOVERSION", "GOOS", "GOARCH", "GOFLAGS")
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return goEnv{}, fmt.Errorf("go env: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	var env goEnv
+	if err := json.Unmarshal(out, &env); err != nil {
+		return goEnv{}, fmt.Errorf("go env: %w", err)
+	}
+	return env, nil
+}
+
+// loadStdSet returns the std packages from the disk cache, listing them with
+// the go command when they are not cached yet. It also returns the Go
+// environment.
+func loadStdSet() (map[pkgPath]bool, goEnv, error) {
+	env, err := readGoEnv()
+	if err != nil {
+		return nil, goEnv{}, err
+	}
+	cache := stdCachePath(env)
+	if set, err := readStdCache(cache); err == nil {
+		return set, env, nil
+	}
+
+	pkgs, err := packages.Load(&packages.Config{Mode: packages.NeedName}, "std")
+	if err != nil {
+		return nil, env, fmt.Errorf("list std packages: %w", err)
+	}
+	set := make(map[pkgPath]bool, len(pkgs))
+	for _, p := range pkgs {
+		set[pkgPath(p.PkgPath)] = true
+	}
+	if cache != "" {
+		// a missing cache only costs time
+		_ = writeStdCache(cache, set)
+	}
+	return set, env, nil
+}
+
+// stdCachePath returns the cache file of the std packages of env, or "" when
+// there is no user cache directory.
+func stdCachePath(env goEnv) string {
+	dir, err := cachedir.Dir()
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(strings.Join([]string{env.GOROOT, env.GOVERSION, env.GOOS, env.GOARCH, env.GOFLAGS}, "\x00")))
+	return filepath.Join(dir, "std-"+hex.EncodeToString(sum[:8])+".txt")
+}
+
+func readStdCache(path string) (map[pkgPath]bool, error) {
+	if path == "" {
+		return nil, os.ErrNotExist
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	set := make(map[pkgPath]bool)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if line := sc.Text(); line != "" {
+			set[pkgPath(line)] = true
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(set) == 0 {
+		return nil, fmt.Errorf("%s is empty", path)
+	}
+	return set, nil
+}
+
+func writeStdCache(path string, set map[pkgPath]bool) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	for _, pp := range slices.Sorted(maps.Keys(set)) {
+		buf.WriteString(string(pp))
+		buf.WriteByte('\n')
+	}
+	return atomicfile.Write(path, buf.Bytes())
+}
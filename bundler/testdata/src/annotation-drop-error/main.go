@@ -0,0 +1,12 @@
+package main
+
+import "fmt"
+
+//bundler:drop
+func debug() {
+	fmt.Println("debug")
+}
+
+func main() {
+	debug()
+}
@@ -0,0 +1,15 @@
+package main
+
+import "fmt"
+
+type T struct{}
+
+//bundler:drop
+func (T) String() string {
+	return "T"
+}
+
+func main() {
+	var s fmt.Stringer = T{}
+	_ = s
+}
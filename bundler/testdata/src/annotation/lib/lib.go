@@ -0,0 +1,31 @@
+package lib
+
+import "fmt"
+
+type Point struct {
+	X, Y int
+}
+
+func (p Point) Sum() int {
+	return p.X + p.Y
+}
+
+// String is only used for debugging.
+//
+//bundler:drop
+func (p Point) String() string {
+	return fmt.Sprintf("(%d, %d)", p.X, p.Y)
+}
+
+// Dump is called through reflection.
+//
+//bundler:keep
+func Dump(p Point) {
+	fmt.Println(p.X, p.Y)
+}
+
+//bundler:keep
+const (
+	Origin = 0
+	Unit   = 1
+)
@@ -0,0 +1,8 @@
+package main
+
+import "github.com/Atnuhs/go-bundler/bundler/testdata/src/annotation/lib"
+
+func main() {
+	p := lib.Point{X: 1, Y: 2}
+	_ = p.Sum()
+}
@@ -0,0 +1,10 @@
+package dbg
+
+import (
+	"fmt"
+	"os"
+)
+
+func Printf(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, format, args...)
+}
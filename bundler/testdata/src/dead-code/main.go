@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/Atnuhs/go-bundler/bundler/testdata/src/dead-code/dbg"
+)
+
+const debug = false
+
+const level = 1
+
+// trace is derived from debug, so overriding debug changes it too
+const trace = debug && level > 0
+
+func check(x int) {
+	if x < 0 {
+		panic("negative")
+	}
+}
+
+func verbose() string {
+	return "verbose"
+}
+
+func main() {
+	n := 10
+	if debug {
+		check(n)
+	} else if level > 2 {
+		fmt.Println(verbose())
+	}
+	sum := n * 2
+	dbg.Printf("sum=%d\n", sum)
+	if trace {
+		fmt.Println("trace")
+	}
+	fmt.Println(n, debug)
+}
@@ -0,0 +1,13 @@
+package main
+
+import (
+	. "github.com/Atnuhs/go-bundler/bundler/testdata/src/dot-import-multi/liba"
+	. "github.com/Atnuhs/go-bundler/bundler/testdata/src/dot-import-multi/libb"
+)
+
+func main() {
+	a := FuncA()
+	b := FuncB()
+	_ = TypeA{Value: a.Value}
+	_ = TypeB{Value: b.Value}
+}
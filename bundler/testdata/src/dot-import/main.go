@@ -1,7 +1,7 @@
 package main
 
 import (
-	. "github.com/Atnuhs/go-bundler/testdata/src/dot-import/lib"
+	. "github.com/Atnuhs/go-bundler/bundler/testdata/src/dot-import/lib"
 )
 
 func useLib(x LibStruct) LibStruct { return x }
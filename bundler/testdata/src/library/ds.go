@@ -0,0 +1,46 @@
+// Package ds is a library bundled without a main package.
+package ds
+
+import "github.com/Atnuhs/go-bundler/bundler/testdata/src/library/mathx"
+
+const Inf = 1 << 60
+
+type UnionFind struct {
+	parent []int
+}
+
+func NewUnionFind(n int) *UnionFind {
+	parent := make([]int, n)
+	for i := range parent {
+		parent[i] = -1
+	}
+	return &UnionFind{parent: parent}
+}
+
+func (u *UnionFind) Find(x int) int {
+	if u.parent[x] < 0 {
+		return x
+	}
+	u.parent[x] = u.Find(u.parent[x])
+	return u.parent[x]
+}
+
+func (u *UnionFind) Union(x, y int) {
+	x, y = u.Find(x), u.Find(y)
+	if x != y {
+		u.parent[mathx.Min(x, y)] += u.parent[y]
+		u.parent[y] = x
+	}
+}
+
+type Stack[T any] struct {
+	items []T
+}
+
+func (s *Stack[T]) Push(x T) {
+	s.items = append(s.items, grow(x))
+}
+
+func grow[T any](x T) T { return x }
+
+func unused() {}
@@ -0,0 +1,23 @@
+package mathx
+
+import "sort"
+
+func Min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func Abs(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+// Median sorts a and returns its middle element.
+func Median(a []int) int {
+	sort.Ints(a)
+	return a[len(a)/2]
+}
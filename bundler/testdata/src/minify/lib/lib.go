@@ -0,0 +1,49 @@
+package lib
+
+type Stack[T any] struct {
+	items []T
+}
+
+func NewStack[T any]() *Stack[T] {
+	return &Stack[T]{}
+}
+
+func (s *Stack[T]) Push(v T) {
+	s.items = append(s.items, v)
+}
+
+func (s *Stack[T]) Pop() T {
+	v := s.items[len(s.items)-1]
+	s.items = s.items[:len(s.items)-1]
+	return v
+}
+
+func (s *Stack[T]) Empty() bool {
+	return len(s.items) == 0
+}
+
+type adder interface {
+	add(n int)
+}
+
+type base struct {
+	value int
+}
+
+func (b *base) add(n int) {
+	b.value += n
+}
+
+// Counter embeds base and counts values.
+type Counter struct {
+	base
+}
+
+func (c *Counter) Add(n int) {
+	var a adder = &c.base
+	a.add(n)
+}
+
+func (c *Counter) Value() int {
+	return c.value
+}
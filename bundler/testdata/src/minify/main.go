@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/Atnuhs/go-bundler/bundler/testdata/src/minify/lib"
+)
+
+type printed struct {
+	Name  string
+	count int
+}
+
+const usage = `usage:
+
+  minify`
+
+func describe(v any) string {
+	switch x := v.(type) {
+	case int:
+		return fmt.Sprint("int", x)
+	case string:
+		return "string " + x
+	}
+	return "other"
+}
+
+func main() {
+	st := lib.NewStack[int]()
+	for i := 0; i < 3; i++ {
+		st.Push(i)
+	}
+	total := 0
+	for !st.Empty() {
+		total += st.Pop()
+	}
+	c := lib.Counter{}
+	c.Add(total)
+	fmt.Println(c.Value(), describe(total), describe("x"))
+	fmt.Printf("%+v\n", printed{Name: "p", count: 1})
+	fmt.Println(usage)
+}
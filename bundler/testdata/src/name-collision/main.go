@@ -0,0 +1,11 @@
+package main
+
+import (
+	liba "github.com/Atnuhs/go-bundler/bundler/testdata/src/name-collision/liba"
+	libb "github.com/Atnuhs/go-bundler/bundler/testdata/src/name-collision/libb"
+)
+
+func main() {
+	liba.FuncA()
+	libb.FuncB()
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/Atnuhs/go-bundler/bundler/testdata/src/prune-fields/segtree"
+)
+
+func main() {
+	s := segtree.New(4)
+	s.Set(1, 3)
+	s.Set(2, 4)
+	fmt.Println(s.Sum(0, 4))
+
+	fmt.Printf("%+v\n", segtree.Point{X: 1})
+	p := segtree.Pair{1, 2}
+	fmt.Println(p.A)
+	e := segtree.Edge{From: 1, To: 2}
+	fmt.Println(e == segtree.Edge{From: 1, To: 2})
+}
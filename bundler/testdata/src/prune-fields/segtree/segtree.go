@@ -0,0 +1,63 @@
+package segtree
+
+// SegTree is a segment tree of sums. lazy is only used by range updates.
+type SegTree struct {
+	n    int
+	data []int
+	lazy []int
+}
+
+func New(n int) *SegTree {
+	return &SegTree{n: n, data: make([]int, 2*n)}
+}
+
+func (s *SegTree) Set(i, x int) {
+	i += s.n
+	s.data[i] = x
+	for i > 1 {
+		i /= 2
+		s.data[i] = s.data[2*i] + s.data[2*i+1]
+	}
+}
+
+func (s *SegTree) Sum(l, r int) int {
+	sum := 0
+	for l, r = l+s.n, r+s.n; l < r; l, r = l/2, r/2 {
+		if l%2 == 1 {
+			sum += s.data[l]
+			l++
+		}
+		if r%2 == 1 {
+			r--
+			sum += s.data[r]
+		}
+	}
+	return sum
+}
+
+// RangeAdd is never called by main.
+func (s *SegTree) RangeAdd(l, r, x int) {
+	if s.lazy == nil {
+		s.lazy = make([]int, 2*s.n)
+	}
+	for i := l + s.n; i < r+s.n; i++ {
+		s.lazy[i] += x
+	}
+}
+
+// Point is printed, so its fields are kept.
+type Point struct {
+	X, Y  int
+	label string
+}
+
+// Pair is built without keys, so its fields are kept.
+type Pair struct {
+	A, B int
+}
+
+// Edge is compared, so its fields are kept.
+type Edge struct {
+	From, To int
+	Weight   int
+}
@@ -0,0 +1,44 @@
+package main
+
+import "fmt"
+
+type Weekday int
+
+const (
+	Sunday Weekday = iota
+	Monday
+	Tuesday
+	Wednesday
+	Thursday
+)
+
+const (
+	_  = iota
+	KB = 1 << (10 * iota)
+	MB
+	GB
+)
+
+const (
+	Red, Crimson = iota, iota * 10
+	Green, Lime
+	Blue, Navy
+)
+
+func next() int {
+	fmt.Println("next")
+	return 1
+}
+
+func pair() (int, int) { return 2, 3 }
+
+var a, b, c = 1, 2, next()
+
+var x, y = pair()
+
+func main() {
+	fmt.Println(Monday, Wednesday)
+	fmt.Println(GB)
+	fmt.Println(Lime, Blue)
+	fmt.Println(a, x)
+}
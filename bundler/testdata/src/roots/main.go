@@ -0,0 +1,19 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/Atnuhs/go-bundler/bundler/testdata/src/roots/solvers"
+	"github.com/Atnuhs/go-bundler/bundler/testdata/src/roots/yaml.v3"
+)
+
+func helper() {
+	fmt.Println("helper")
+}
+
+func main() {
+	var name string
+	fmt.Scan(&name)
+	solvers.Run(name)
+	_ = yaml.Node{}
+}
@@ -0,0 +1,24 @@
+package solvers
+
+import "fmt"
+
+// Table is filled at run time by code outside the bundle.
+var Table = map[string]func(){}
+
+func Run(name string) {
+	if f, ok := Table[name]; ok {
+		f()
+	}
+}
+
+func SolveA() {
+	fmt.Println("A")
+}
+
+type B struct{}
+
+func (B) Solve() {
+	fmt.Println("B")
+}
+
+func Unused() {}
@@ -0,0 +1,12 @@
+package yaml
+
+import "fmt"
+
+// Node has a dot in its import path, like gopkg.in/yaml.v3.
+type Node struct{}
+
+func (Node) Decode() {
+	fmt.Println("decode")
+}
+
+func Unused() {}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+	"sort"
+	"strconv"
+)
+
+type options struct {
+	desc  bool
+	limit int
+}
+
+var opts options
+
+type byKey []int
+
+func (a byKey) Len() int           { return len(a) }
+func (a byKey) Less(i, j int) bool { return (a[i] < a[j]) != opts.desc }
+func (a byKey) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+
+type counter struct {
+	calls int
+	spare int
+}
+
+func (c *counter) less(a, b int) bool {
+	c.calls++
+	return a < b
+}
+
+func main() {
+	keys := byKey{1, 2}
+	sort.Sort(keys)
+
+	c := &counter{}
+	nums := []int{3, 1, 2}
+	sort.Slice(nums, func(i, j int) bool { return c.less(nums[i], nums[j]) })
+	os.Stdout.WriteString(strconv.Itoa(keys[0]+nums[0]) + "\n")
+}
@@ -0,0 +1,7 @@
+package main
+
+import "github.com/Atnuhs/go-bundler/bundler/testdata/src/tree-shaking/lib"
+
+func main() {
+	lib.UsedFunc()
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Atnuhs/go-bundler/bundler"
+	"github.com/Atnuhs/go-bundler/internal/atomicfile"
+	"github.com/Atnuhs/go-bundler/internal/cachedir"
+)
+
+// outputCache keeps finished bundles in the user cache directory, keyed by
+// the target directory, the options, the Go environment and the bundler
+// binary. An entry records the hash of every file it was built from and is
+// used only while none of them changed and no Go file was added next to them.
+type outputCache struct {
+	dir string
+}
+
+func openOutputCache() (*outputCache, error) {
+	dir, err := cachedir.Dir()
+	if err != nil {
+		return nil, err
+	}
+	return &outputCache{dir: filepath.Join(dir, "out")}, nil
+}
+
+// cacheEntry is a cached bundle with the inputs it was built from.
+type cacheEntry struct {
+	Request serveRequest      `json:"request"`
+	Files   map[string]string `json:"files"` // SHA-256 by path; "" for a missing file
+	Bundle  string            `json:"bundle"`
+	Report  *bundler.Report   `json:"report"`
+	Created time.Time         `json:"created"`
+}
+
+// key returns the cache key of req.
+func (c *outputCache) key(req serveRequest) (string, error) {
+	env, err := goEnvJSON(req.Dir)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(struct {
+		Request serveRequest
+		Env     json.RawMessage
+		Bundler string
+	}{req, env, executableID()})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func (c *outputCache) path(key string) string {
+	return filepath.Join(c.dir, key+".json")
+}
+
+// get returns the entry of key if none of its inputs changed.
+func (c *outputCache) get(key string) (*cacheEntry, bool) {
+	e, err := readCacheEntry(c.path(key))
+	if err != nil || !e.fresh() {
+		return nil, false
+	}
+	return e, true
+}
+
+func (c *outputCache) put(key string, req serveRequest, out []byte, report *bundler.Report) error {
+	e := cacheEntry{
+		Request: req,
+		Files:   make(map[string]string),
+		Bundle:  string(out),
+		Report:  report,
+		Created: time.Now(),
+	}
+	for _, f := range cacheFiles(req.Dir, report) {
+		e.Files[f] = hashFile(f)
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return err
+	}
+	return atomicfile.Write(c.path(key), data)
+}
+
+// entries returns the paths of all entries.
+func (c *outputCache) entries() ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(c.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(paths)
+	return paths, nil
+}
+
+func readCacheEntry(path string) (*cacheEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var e cacheEntry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if e.Report == nil {
+		return nil, fmt.Errorf("%s: no report", path)
+	}
+	return &e, nil
+}
+
+// fresh reports whether the inputs of e are the same files with the same
+// contents as when it was stored.
+func (e *cacheEntry) fresh() bool {
+	files := cacheFiles(e.Request.Dir, e.Report)
+	if len(files) != len(e.Files) {
+		return false
+	}
+	for _, f := range files {
+		if sum, ok := e.Files[f]; !ok || hashFile(f) != sum {
+			return false
+		}
+	}
+	return true
+}
+
+// cacheFiles returns the files a bundle of dir depends on: the files -watch
+// would watch and the module files of dir and its parents.
+func cacheFiles(dir string, report *bundler.Report) []string {
+	set := make(map[string]bool)
+	for _, f := range watchFiles(dir, report, nil) {
+		set[f] = true
+	}
+	if d, err := filepath.Abs(dir); err == nil {
+		for {
+			for _, name := range []string{"go.mod", "go.sum", "go.work", "go.work.sum"} {
+				if path := filepath.Join(d, name); fileExists(path) {
+					set[path] = true
+				}
+			}
+			parent := filepath.Dir(d)
+			if parent == d {
+				break
+			}
+			d = parent
+		}
+	}
+	return slices.Sorted(maps.Keys(set))
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func hashFile(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// goEnvJSON returns the Go environment in dir that changes what a bundle of
+// the same sources looks like. CGO_ENABLED selects files by build constraint
+// and GOWORK, the go.work in effect for dir, the versions of other modules.
+func goEnvJSON(dir string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("go", "env", "-json", "GOROOT", "GOVERSION", "GOOS", "GOARCH", "GOFLAGS", "GOEXPERIMENT", "CGO_ENABLED", "GOWORK")
+	cmd.Dir = dir
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("go env: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// executableID identifies the running bundler binary, so that entries of
+// other versions are not used.
+func executableID() string {
+	exe, err := os.Executable()
+	if err != nil {
+		return ""
+	}
+	fi, err := os.Stat(exe)
+	if err != nil {
+		return exe
+	}
+	return fmt.Sprintf("%s %d %d", exe, fi.Size(), fi.ModTime().UnixNano())
+}
+
+// runCache implements "go-bundler cache".
+func runCache(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("cache", flag.ExitOnError)
+	stale := fs.Bool("stale", false, "with clean, remove only the entries whose inputs changed")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), `usage: go-bundler cache [-stale] list | clean | dir
+
+  list   print the cached bundles
+  clean  remove cached bundles
+  dir    print the cache directory`)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("cache: expected one command")
+	}
+	c, err := openOutputCache()
+	if err != nil {
+		return err
+	}
+
+	switch fs.Arg(0) {
+	case "dir":
+		fmt.Fprintln(w, c.dir)
+		return nil
+	case "list":
+		return c.list(w)
+	case "clean":
+		return c.clean(w, *stale)
+	}
+	fs.Usage()
+	return fmt.Errorf("cache: unknown command %q", fs.Arg(0))
+}
+
+// list writes a table of the entries to w.
+func (c *outputCache) list(w io.Writer) error {
+	paths, err := c.entries()
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "KEY\tSTATUS\tBYTES\tCREATED\tDIR")
+	for _, path := range paths {
+		key := strings.TrimSuffix(filepath.Base(path), ".json")
+		key = key[:min(len(key), 12)]
+		e, err := readCacheEntry(path)
+		if err != nil {
+			fmt.Fprintf(tw, "%s\tinvalid\t-\t-\t-\n", key)
+			continue
+		}
+		status := "fresh"
+		if !e.fresh() {
+			status = "stale"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\n", key, status, len(e.Bundle), e.Created.Format(time.DateTime), e.Request.Dir)
+	}
+	return tw.Flush()
+}
+
+// clean removes all entries, or only the stale and invalid ones.
+func (c *outputCache) clean(w io.Writer, staleOnly bool) error {
+	paths, err := c.entries()
+	if err != nil {
+		return err
+	}
+	removed := 0
+	for _, path := range paths {
+		if staleOnly {
+			if e, err := readCacheEntry(path); err == nil && e.fresh() {
+				continue
+			}
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		removed++
+	}
+	fmt.Fprintf(w, "removed %d of %d cached bundles\n", removed, len(paths))
+	return nil
+}
+
+// runCached is bundler.Run backed by the output cache: the bundle of an
+// earlier run is returned without loading anything when none of its inputs
+// changed. A cache that cannot be used only costs time.
+func runCached(opts bundler.Options) (*bundler.Result, error) {
+	start := time.Now()
+	c, err := openOutputCache()
+	if err != nil {
+		return bundler.Run(opts)
+	}
+	req := newServeRequest(opts)
+	key, err := c.key(req)
+	if err != nil {
+		return bundler.Run(opts)
+	}
+	if e, ok := c.get(key); ok {
+		e.Report.Timings = []bundler.PhaseTiming{{Phase: "cache", DurationMS: float64(time.Since(start).Microseconds()) / 1000}}
+		return &bundler.Result{Source: []byte(e.Bundle), Report: e.Report}, nil
+	}
+	res, err := bundler.Run(opts)
+	if err == nil {
+		_ = c.put(key, req, res.Source, res.Report)
+	}
+	return res, err
+}
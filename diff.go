@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines around each hunk.
+const diffContext = 3
+
+// diffOp is one line of an edit script: ' ' keeps a[a], '-' deletes a[a] and
+// '+' inserts b[b]. a and b are the positions in both inputs at the line.
+type diffOp struct {
+	kind byte
+	a, b int
+}
+
+// checkBundle compares the bundle with the file at path. When they differ,
+// it writes a unified diff from the file to the bundle to w and returns an error.
+func checkBundle(path string, bundle []byte, w io.Writer) error {
+	current, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if bytes.Equal(current, bundle) {
+		return nil
+	}
+	if _, err := w.Write(unifiedDiff(path, path+" (bundled)", current, bundle)); err != nil {
+		return err
+	}
+	return fmt.Errorf("%s is out of date", path)
+}
+
+// unifiedDiff returns the unified diff from a to b, or nil when they are equal.
+func unifiedDiff(nameA, nameB string, a, b []byte) []byte {
+	linesA, linesB := splitLines(a), splitLines(b)
+	ops := diffLines(linesA, linesB)
+
+	var buf bytes.Buffer
+	for _, h := range hunks(ops) {
+		if buf.Len() == 0 {
+			fmt.Fprintf(&buf, "--- %s\n+++ %s\n", nameA, nameB)
+		}
+		first := h[0]
+		startA, startB := first.a+1, first.b+1
+		countA, countB := 0, 0
+		for _, op := range h {
+			if op.kind != '+' {
+				countA++
+			}
+			if op.kind != '-' {
+				countB++
+			}
+		}
+		if countA == 0 {
+			startA--
+		}
+		if countB == 0 {
+			startB--
+		}
+		fmt.Fprintf(&buf, "@@ -%s +%s @@\n", hunkRange(startA, countA), hunkRange(startB, countB))
+		for _, op := range h {
+			line := ""
+			if op.kind == '+' {
+				line = linesB[op.b]
+			} else {
+				line = linesA[op.a]
+			}
+			buf.WriteByte(op.kind)
+			buf.WriteString(line)
+			if !strings.HasSuffix(line, "\n") {
+				buf.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+	}
+	if buf.Len() == 0 {
+		return nil
+	}
+	return buf.Bytes()
+}
+
+func hunkRange(start, count int) string {
+	if count == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// splitLines splits s into lines that keep their newline, so that a last
+// line without one differs from the same line with one.
+func splitLines(s []byte) []string {
+	if len(s) == 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(string(s), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// hunks groups the edit script into hunks of changes with diffContext lines
+// of context, merging hunks whose contexts overlap.
+func hunks(ops []diffOp) [][]diffOp {
+	var ret [][]diffOp
+	start, end := -1, -1 // range of ops in the current hunk
+	for i, op := range ops {
+		if op.kind == ' ' {
+			continue
+		}
+		if start >= 0 && i-end > 2*diffContext {
+			ret = append(ret, ops[start:end])
+			start = -1
+		}
+		if start < 0 {
+			start = max(i-diffContext, 0)
+		}
+		end = min(i+1+diffContext, len(ops))
+	}
+	if start >= 0 {
+		ret = append(ret, ops[start:end])
+	}
+	return ret
+}
+
+// diffLines returns the shortest edit script from a to b using the
+// linear-space variant of Myers' algorithm: the middle snake of an optimal
+// path splits the inputs, and both halves are diffed recursively.
+func diffLines(a, b []string) []diffOp {
+	d := &differ{a: a, b: b}
+	d.compare(0, len(a), 0, len(b))
+	return d.ops
+}
+
+type differ struct {
+	// input
+	a, b []string
+
+	// output
+	ops []diffOp
+}
+
+// compare appends the edit script from a[a0:a1] to b[b0:b1].
+func (d *differ) compare(a0, a1, b0, b1 int) {
+	for a0 < a1 && b0 < b1 && d.a[a0] == d.b[b0] {
+		d.ops = append(d.ops, diffOp{' ', a0, b0})
+		a0, b0 = a0+1, b0+1
+	}
+	suffix := 0
+	for a0 < a1-suffix && b0 < b1-suffix && d.a[a1-suffix-1] == d.b[b1-suffix-1] {
+		suffix++
+	}
+	a1, b1 = a1-suffix, b1-suffix
+
+	switch {
+	case a0 == a1:
+		for y := b0; y < b1; y++ {
+			d.ops = append(d.ops, diffOp{'+', a0, y})
+		}
+	case b0 == b1:
+		for x := a0; x < a1; x++ {
+			d.ops = append(d.ops, diffOp{'-', x, b0})
+		}
+	default:
+		// both halves have at least one edit, as a common prefix and
+		// suffix are gone, so neither is the whole range again
+		x, y := d.middleSnake(a0, a1, b0, b1)
+		d.compare(a0, x, b0, y)
+		d.compare(x, a1, y, b1)
+	}
+
+	for i := range suffix {
+		d.ops = append(d.ops, diffOp{' ', a1 + i, b1 + i})
+	}
+}
+
+// middleSnake returns a point of an optimal path from (a0, b0) to (a1, b1),
+// found where the paths searched from both ends meet. It keeps only the
+// furthest points of the current step, so it takes space linear in the input.
+func (d *differ) middleSnake(a0, a1, b0, b1 int) (int, int) {
+	n, m := a1-a0, b1-b0
+	maxD := (n + m + 1) / 2
+	offset := maxD + 1
+	// vf[offset+k] is the furthest x on diagonal k = x-y from the start,
+	// vb[offset+k] the furthest x from the end in reversed coordinates
+	vf := make([]int, 2*offset+1)
+	vb := make([]int, 2*offset+1)
+	for i := range vf {
+		vf[i], vb[i] = -1, -1
+	}
+	vf[offset+1], vb[offset+1] = 0, 0
+	delta := n - m
+	odd := delta%2 != 0
+	// the diagonals that left the grid are not searched again
+	fStart, fEnd, bStart, bEnd := 0, 0, 0, 0
+	for D := 0; D <= maxD; D++ {
+		for k := -D + fStart; k <= D-fEnd; k += 2 {
+			var x int
+			if k == -D || k != D && vf[offset+k-1] < vf[offset+k+1] {
+				x = vf[offset+k+1]
+			} else {
+				x = vf[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && d.a[a0+x] == d.b[b0+y] {
+				x, y = x+1, y+1
+			}
+			vf[offset+k] = x
+			switch {
+			case x > n:
+				fEnd += 2
+			case y > m:
+				fStart += 2
+			case odd:
+				if i := offset + delta - k; i >= 0 && i < len(vb) && vb[i] >= 0 && x >= n-vb[i] {
+					return a0 + x, b0 + y
+				}
+			}
+		}
+		for k := -D + bStart; k <= D-bEnd; k += 2 {
+			var x int
+			if k == -D || k != D && vb[offset+k-1] < vb[offset+k+1] {
+				x = vb[offset+k+1]
+			} else {
+				x = vb[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && d.a[a1-x-1] == d.b[b1-y-1] {
+				x, y = x+1, y+1
+			}
+			vb[offset+k] = x
+			switch {
+			case x > n:
+				bEnd += 2
+			case y > m:
+				bStart += 2
+			case !odd:
+				if i := offset + delta - k; i >= 0 && i < len(vf) && vf[i] >= 0 && vf[i] >= n-x {
+					fx := vf[i]
+					return a0 + fx, b0 + fx - (i - offset)
+				}
+			}
+		}
+	}
+	panic("paths do not meet")
+}
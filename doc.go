@@ -4,4 +4,7 @@
 // It can optionally emit metrics and “sustainability” comment blocks
 // (line counts, CO2 reduction estimates, and tree equivalents) in the
 // generated source file.
+//
+// The command is a thin wrapper around package
+// github.com/Atnuhs/go-bundler/bundler, which other tools can import.
 package main
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Atnuhs/go-bundler/bundler"
+	"golang.org/x/tools/go/packages"
+)
+
+// runExtract implements "go-bundler extract importpath.Name". It prints the
+// named declaration (a function, type, var, const or "Type.Method") with its
+// transitive dependencies and the std imports they need, without a package
+// clause or main, to paste into an existing file.
+func runExtract(args []string) error {
+	fs := flag.NewFlagSet("extract", flag.ExitOnError)
+	dir := fs.String("dir", ".", "directory the import path is resolved from")
+	prefix := fs.String("prefix", "", "prepend `prefix` to every name of the extracted package, e.g. uf_")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: go-bundler extract [flags] importpath.Name")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("extract: expected one importpath.Name")
+	}
+
+	res, err := extractSnippet(*dir, fs.Arg(0), *prefix)
+	if res != nil {
+		for _, d := range res.Diagnostics {
+			fmt.Fprintln(os.Stderr, d)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(res.Source)
+	return err
+}
+
+// extractSnippet bundles the declaration named by target ("importpath.Name")
+// and its dependencies without a package clause. The import path is the
+// longest prefix of target that names a package found from dir.
+func extractSnippet(dir, target, prefix string) (*bundler.Result, error) {
+	var pkgs []*packages.Package
+	path, name, ok := bundler.SplitQualifiedName(target, func(path string) bool {
+		loaded, err := bundler.Load(bundler.Options{Dir: dir, Patterns: []string{path}})
+		if err != nil || len(loaded) != 1 || len(loaded[0].GoFiles) == 0 {
+			return false
+		}
+		pkgs = loaded
+		return true
+	})
+	if !ok {
+		return nil, fmt.Errorf("expected importpath.Name of a package found from %s, got %q", dir, target)
+	}
+	res, err := bundler.Bundle(pkgs, bundler.Options{
+		Library: true,
+		Roots:   []string{name},
+		Prefix:  prefix,
+		Snippet: true,
+	})
+	if err != nil {
+		return res, fmt.Errorf("extract %s.%s: %w", path, name, err)
+	}
+	return res, nil
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing/fstest"
+
+	"golang.org/x/mod/modfile"
+)
+
+// revFS returns the repository holding dir as of the git revision rev,
+// limited to the module of dir, the modules it replaces with local paths and
+// those of a go.work above it, and the path of dir in it. The files are read
+// from the object database of the repository, so the working tree and the
+// index are left alone.
+//
+// The module root is the directory of the go.mod governing dir in the
+// working tree; it must exist at rev too.
+func revFS(dir, rev string) (fs.FS, string, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, "", err
+	}
+	// git reports the top level with symlinks resolved
+	if absDir, err = filepath.EvalSymlinks(absDir); err != nil {
+		return nil, "", err
+	}
+	top, err := git(absDir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, "", err
+	}
+	commit, err := git(absDir, "rev-parse", "--verify", "--end-of-options", rev+"^{commit}")
+	if err != nil {
+		return nil, "", fmt.Errorf("unknown revision %q: %w", rev, err)
+	}
+	modDir, err := moduleRoot(absDir, string(top))
+	if err != nil {
+		return nil, "", err
+	}
+	r := &revReader{top: string(top), commit: string(commit), rev: rev}
+	mod, err := r.rel(modDir)
+	if err != nil {
+		return nil, "", err
+	}
+	sub, err := r.rel(absDir)
+	if err != nil {
+		return nil, "", err
+	}
+	paths, err := r.modulePaths(mod)
+	if err != nil {
+		return nil, "", err
+	}
+
+	args := append([]string{"ls-tree", "-r", "-z", "--full-tree", r.commit, "--"}, paths...)
+	tree, err := git(r.top, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	var names, objects []string
+	for _, entry := range bytes.Split(tree, []byte{0}) {
+		// <mode> SP <type> SP <object> TAB <path>
+		info, name, ok := strings.Cut(string(entry), "\t")
+		fields := strings.Fields(info)
+		if !ok || len(fields) != 3 || fields[1] != "blob" || fields[0] == "120000" {
+			// submodules and symlinks are not part of the module
+			continue
+		}
+		names = append(names, name)
+		objects = append(objects, fields[2])
+	}
+	blobs, err := readBlobs(r.top, objects)
+	if err != nil {
+		return nil, "", err
+	}
+	fsys := make(fstest.MapFS, len(names))
+	for i, name := range names {
+		fsys[name] = &fstest.MapFile{Data: blobs[i], Mode: 0644}
+	}
+	return fsys, sub, nil
+}
+
+// revReader reads files of a repository at a revision.
+type revReader struct {
+	top    string // top level of the working tree
+	commit string
+	rev    string // as given, for messages
+}
+
+// rel returns the slash-separated path of the absolute path in the repository.
+func (r *revReader) rel(abs string) (string, error) {
+	rel, err := filepath.Rel(r.top, abs)
+	if err != nil || !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("%s is outside the repository %s", abs, r.top)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// modulePaths returns the paths in the repository to read for the module
+// at mod: its directory, the directories of the modules it replaces with a
+// local path, recursively, and a go.work above it with its modules.
+func (r *revReader) modulePaths(mod string) ([]string, error) {
+	var paths, queue []string
+	for d := mod; ; d = path.Dir(d) {
+		name := path.Join(d, "go.work")
+		data, ok, err := r.readFile(name)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			wf, err := modfile.ParseWork(name, data, nil)
+			if err != nil {
+				return nil, fmt.Errorf("%s at %s: %w", name, r.rev, err)
+			}
+			paths = append(paths, name, path.Join(d, "go.work.sum"))
+			for _, u := range wf.Use {
+				use, err := r.localPath(d, u.Path, name)
+				if err != nil {
+					return nil, err
+				}
+				queue = append(queue, use)
+			}
+			for _, rep := range wf.Replace {
+				if modfile.IsDirectoryPath(rep.New.Path) {
+					dir, err := r.localPath(d, rep.New.Path, name)
+					if err != nil {
+						return nil, err
+					}
+					queue = append(queue, dir)
+				}
+			}
+			break
+		}
+		if d == "." {
+			break
+		}
+	}
+
+	queue = append(queue, mod)
+	seen := make(map[string]bool)
+	for len(queue) > 0 {
+		d := queue[0]
+		queue = queue[1:]
+		if seen[d] {
+			continue
+		}
+		seen[d] = true
+		paths = append(paths, d)
+
+		name := path.Join(d, "go.mod")
+		data, ok, err := r.readFile(name)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("%s does not exist at %s", name, r.rev)
+		}
+		mf, err := modfile.Parse(name, data, nil)
+		if err != nil {
+			return nil, fmt.Errorf("%s at %s: %w", name, r.rev, err)
+		}
+		for _, rep := range mf.Replace {
+			if !modfile.IsDirectoryPath(rep.New.Path) {
+				continue
+			}
+			dir, err := r.localPath(d, rep.New.Path, name)
+			if err != nil {
+				return nil, err
+			}
+			queue = append(queue, dir)
+		}
+	}
+	return paths, nil
+}
+
+// localPath resolves the directory p named in the file from, in directory
+// d, to a path in the repository.
+func (r *revReader) localPath(d, p, from string) (string, error) {
+	p = filepath.ToSlash(p)
+	if path.IsAbs(p) || filepath.IsAbs(p) {
+		return "", fmt.Errorf("%s refers to %s, which cannot be read at a revision; use a path relative to the module", from, p)
+	}
+	joined := path.Join(d, p)
+	if !fs.ValidPath(joined) {
+		return "", fmt.Errorf("%s refers to %s, which is outside the repository and cannot be read at a revision", from, p)
+	}
+	return joined, nil
+}
+
+// readFile returns the contents of the file name at the revision, and
+// whether it exists.
+func (r *revReader) readFile(name string) ([]byte, bool, error) {
+	out, err := git(r.top, "ls-tree", "-z", "--full-tree", r.commit, "--", name)
+	if err != nil {
+		return nil, false, err
+	}
+	info, _, ok := bytes.Cut(out, []byte{'\t'})
+	fields := strings.Fields(string(info))
+	if !ok || len(fields) != 3 || fields[1] != "blob" {
+		return nil, false, nil
+	}
+	blobs, err := readBlobs(r.top, fields[2:])
+	if err != nil {
+		return nil, false, err
+	}
+	return blobs[0], true, nil
+}
+
+// moduleRoot returns the nearest directory from dir up to top holding go.mod.
+func moduleRoot(dir, top string) (string, error) {
+	for d := dir; ; d = filepath.Dir(d) {
+		if fileExists(filepath.Join(d, "go.mod")) {
+			return d, nil
+		}
+		if d == top || filepath.Dir(d) == d {
+			return "", fmt.Errorf("no go.mod in %s or its parents in the repository", dir)
+		}
+	}
+}
+
+// readBlobs returns the contents of the objects in one git cat-file run.
+func readBlobs(dir string, objects []string) ([][]byte, error) {
+	cmd := exec.Command("git", "cat-file", "--batch")
+	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader(strings.Join(objects, "\n") + "\n")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	blobs, readErr := readBatch(bufio.NewReader(out), len(objects))
+	// let git finish writing if reading stopped early
+	io.Copy(io.Discard, out)
+	if err := cmd.Wait(); err != nil {
+		return nil, fmt.Errorf("git cat-file: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return blobs, readErr
+}
+
+// readBatch reads n objects in the output format of git cat-file --batch.
+func readBatch(r *bufio.Reader, n int) ([][]byte, error) {
+	blobs := make([][]byte, n)
+	for i := range blobs {
+		header, err := r.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("git cat-file: %w", err)
+		}
+		// <object> SP <type> SP <size> LF <contents> LF
+		fields := strings.Fields(header)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("git cat-file: unexpected header %q", header)
+		}
+		size, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("git cat-file: unexpected header %q", header)
+		}
+		blobs[i] = make([]byte, size+1)
+		if _, err := io.ReadFull(r, blobs[i]); err != nil {
+			return nil, fmt.Errorf("git cat-file: %w", err)
+		}
+		blobs[i] = blobs[i][:size]
+	}
+	return blobs, nil
+}
+
+// git runs git in dir and returns its output without the trailing newline.
+func git(dir string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		var exit *exec.ExitError
+		if errors.As(err, &exit) {
+			return nil, fmt.Errorf("git %s: %s", args[0], strings.TrimSpace(stderr.String()))
+		}
+		return nil, fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return bytes.TrimSuffix(out, []byte("\n")), nil
+}
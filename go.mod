@@ -4,9 +4,9 @@ go 1.24.0
 
 toolchain go1.24.4
 
-require golang.org/x/tools v0.38.0
-
 require (
-	golang.org/x/mod v0.29.0 // indirect
-	golang.org/x/sync v0.17.0 // indirect
+	golang.org/x/mod v0.29.0
+	golang.org/x/tools v0.38.0
 )
+
+require golang.org/x/sync v0.17.0 // indirect
@@ -0,0 +1,24 @@
+// Package cachedir locates the cache directory of go-bundler.
+package cachedir
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Env overrides the cache directory, e.g. to keep tests away from the
+// cache of the user.
+const Env = "GO_BUNDLER_CACHE"
+
+// Dir returns $GO_BUNDLER_CACHE if set, or go-bundler in the user cache
+// directory.
+func Dir() (string, error) {
+	if dir := os.Getenv(Env); dir != "" {
+		return dir, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "go-bundler"), nil
+}
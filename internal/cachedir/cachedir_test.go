@@ -0,0 +1,10 @@
+package cachedir
+
+import "testing"
+
+func TestDir(t *testing.T) {
+	t.Setenv(Env, "/tmp/bundler-cache")
+	if dir, err := Dir(); err != nil || dir != "/tmp/bundler-cache" {
+		t.Errorf("Dir() = %q, %v; want $%s", dir, err, Env)
+	}
+}
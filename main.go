@@ -1,89 +1,271 @@
 package main
 
 import (
-	"bytes"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
-	"path/filepath"
+	"runtime"
 
-	"golang.org/x/tools/go/packages"
-	"golang.org/x/tools/imports"
+	"github.com/Atnuhs/go-bundler/bundler"
+	"github.com/Atnuhs/go-bundler/internal/atomicfile"
 )
 
 var (
 	withMetrics               = flag.Bool("with-metrics", false, "emit go-bundler metrics comment block")
 	withSustainabilityMetrics = flag.Bool("with-sustainability-metrics", false, "emit sustainability metrics (CO2, trees) in comment block")
 	dir                       = flag.String("dir", ".", "target package directory")
+	outPath                   = flag.String("o", "", "write the bundle to `file` instead of stdout; the file is replaced only when bundling succeeds")
+	clipboard                 = flag.Bool("clipboard", false, "copy the bundle to the clipboard with an OSC 52 terminal escape sequence instead of writing it to stdout")
+	clipboardCmd              = flag.String("clipboard-cmd", "", "copy the bundle by piping it to `command` (e.g. pbcopy, wl-copy) instead of OSC 52; implies -clipboard")
+	overlayPath               = flag.String("overlay", "", "read the files named in the JSON `file` from their replacements, as go build -overlay does")
+	stdinFile                 = flag.String("stdin-file", "", "read the contents of the Go file at `path` from stdin, e.g. an unsaved editor buffer")
+	rev                       = flag.String("rev", "", "bundle the module as of the git `revision` (commit, branch or tag) instead of the working tree")
+	socket                    = flag.String("socket", "", "bundle with the go-bundler server listening on the Unix socket at `path` (see go-bundler serve)")
+	useCache                  = flag.Bool("cache", true, "reuse the bundle of an earlier run when no input changed (see go-bundler cache)")
+	watch                     = flag.Bool("watch", false, "rebundle whenever a source file changes, rewriting the -o file or the clipboard")
+	check                     = flag.Bool("check", false, "with -o, fail with a unified diff if the file differs from the bundle, without writing anything")
+	reportPath                = flag.String("report", "", "write a JSON bundle report to `path`")
+	minify                    = flag.Bool("minify", false, "shorten identifiers and strip comments and blank lines of the bundled code")
+	profile                   = flag.String("profile", "", "apply settings of an online judge profile (atcoder, codeforces)")
+	deadCode                  = flag.Bool("dce", false, "remove if branches whose condition is a constant before tree shaking")
+	pruneFields               = flag.Bool("prune-fields", false, "remove struct fields that are never read or written by called code")
+	library                   = flag.Bool("lib", false, "bundle a non-main package as a library; its exported names (or -root) are the roots and stay unprefixed")
+	pkgName                   = flag.String("pkg-name", "", "package `name` of a library bundle (default: name of the target package)")
+	jobs                      = flag.Int("j", runtime.GOMAXPROCS(0), "number of packages bundled concurrently when bundling several packages")
+	order                     = flag.String("order", "kind", "declaration `order`: kind (grouped by kind), package (grouped by package) or source (source order)")
+	prefixStrategy            = flag.String("prefix-strategy", "name", "prefix `strategy` of dependency names: name (package name, numbered on collisions) or path (import path relative to the module)")
+	shake                     = flag.String("shake", "rta", "tree shaking `mode`: rta (SSA and RTA), syntactic (references only, faster) or none (keep every declaration)")
+	maxSize                   sizeFlag
+	defines                   = defineFlag{}
+	stripCalls                listFlag
+	roots                     listFlag
 )
 
+func init() {
+	flag.Var(&maxSize, "max-size", "fail when the bundle exceeds this `size` (e.g. 65536, 64KiB, 512KB); 0 disables the check")
+	flag.Var(defines, "D", "override a constant for dead code elimination, as `name=value` (repeatable; implies -dce)")
+	flag.Var(&roots, "root", "extra reachability root `name`: Name or Type.Method, optionally qualified as importpath.Name (repeatable)")
+	flag.Var(&stripCalls, "strip-call", "remove call statements of a debug-only `function` such as dbg.Printf (repeatable; implies -dce)")
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "extract":
+			if err := runExtract(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "serve":
+			if err := runServe(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "cache":
+			if err := runCache(os.Args[2:], os.Stdout); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
+
 	flag.Parse()
+	if err := applyProfile(); err != nil {
+		log.Fatal(err)
+	}
+	if *check && *outPath == "" {
+		log.Fatal("-check requires -o")
+	}
 
-	pkgs, err := loadPackages(*dir)
+	opts, err := optionsFromFlags()
 	if err != nil {
-		log.Fatalf("load packages: %v", err)
+		log.Fatal(err)
 	}
 
-	// bundle into a single source file
-	var raw bytes.Buffer
-	originalLines, err := Bundle(pkgs, &raw)
-	if err != nil {
-		log.Fatalf("bundle: %v", err)
+	if *socket != "" && (*overlayPath != "" || *stdinFile != "") {
+		log.Fatal("-overlay and -stdin-file cannot be used with -socket")
+	}
+	if *watch && (*overlayPath != "" || *stdinFile != "") {
+		log.Fatal("-overlay and -stdin-file cannot be used with -watch")
+	}
+	if opts.Overlay, err = readOverlay(*overlayPath, *stdinFile, os.Stdin); err != nil {
+		log.Fatal(err)
+	}
+	if *rev != "" {
+		switch {
+		case opts.Overlay != nil:
+			log.Fatal("-rev cannot be used with -overlay or -stdin-file")
+		case *socket != "":
+			log.Fatal("-rev cannot be used with -socket")
+		case *watch:
+			log.Fatal("-rev cannot be used with -watch")
+		}
+		if opts.FS, opts.Dir, err = revFS(*dir, *rev); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if flag.NArg() > 0 {
+		switch {
+		case *watch:
+			log.Fatal("-watch cannot be used with package patterns")
+		case *clipboard || *clipboardCmd != "":
+			log.Fatal("-clipboard cannot be used with package patterns")
+		case *socket != "":
+			log.Fatal("-socket cannot be used with package patterns")
+		case *outPath == "":
+			log.Fatal("package patterns require an -o template, e.g. -o 'bundled/{{.Dir}}.go'")
+		}
+		if err := runBatch(opts, flag.Args(), *jobs, os.Stderr); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if *watch {
+		if *check {
+			log.Fatal("-watch cannot be used with -check")
+		}
+		if *outPath == "" && !*clipboard && *clipboardCmd == "" {
+			log.Fatal("-watch requires -o or -clipboard")
+		}
+		watchAndRun(*dir, watchInterval, []string{*outPath, *reportPath}, func() (*bundler.Report, error) { return run(opts) })
+		return
 	}
 
-	// format bundled source file with goimports
-	formatted, err := imports.Process("main.go", raw.Bytes(), &imports.Options{
-		Comments:  true,
-		TabIndent: true,
-		TabWidth:  4,
-	})
+	if _, err := run(opts); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// optionsFromFlags returns the bundle options set by the command line flags.
+func optionsFromFlags() (bundler.Options, error) {
+	declOrder, err := bundler.ParseOrder(*order)
 	if err != nil {
-		log.Fatalf("goimports: %v", err)
+		return bundler.Options{}, err
 	}
-	bundledLines := bytes.Count(formatted, []byte{'\n'})
+	shakeMode, err := bundler.ParseShake(*shake)
+	if err != nil {
+		return bundler.Options{}, err
+	}
+	prefix, err := bundler.ParsePrefixStrategy(*prefixStrategy)
+	if err != nil {
+		return bundler.Options{}, err
+	}
+	return bundler.Options{
+		Dir:                       *dir,
+		EliminateDeadCode:         *deadCode,
+		Defines:                   defines,
+		StripCalls:                stripCalls,
+		PruneFields:               *pruneFields,
+		PrefixStrategy:            prefix,
+		Order:                     declOrder,
+		Shake:                     shakeMode,
+		Library:                   *library || *pkgName != "",
+		PackageName:               *pkgName,
+		Roots:                     roots,
+		Minify:                    *minify,
+		WithMetrics:               *withMetrics,
+		WithSustainabilityMetrics: *withSustainabilityMetrics,
+		MaxSize:                   int64(maxSize),
+	}, nil
+}
 
-	// output formatted file
-	w := os.Stdout
-	g := NewMetricWriter(originalLines, bundledLines)
-	g.WriteHeader(w)
-	if *withMetrics {
-		g.WriteMetrics(w)
+// run bundles the target package once and writes the output. The report is
+// returned whenever the packages were loaded, even if a later step failed.
+func run(opts bundler.Options) (*bundler.Report, error) {
+	var (
+		res *bundler.Result
+		err error
+	)
+	switch {
+	case *socket != "":
+		res, err = requestBundle(*socket, newServeRequest(opts))
+	case *useCache && opts.Overlay == nil && opts.FS == nil:
+		res, err = runCached(opts)
+	default:
+		res, err = bundler.Run(opts)
 	}
-	if *withSustainabilityMetrics {
-		g.WriteSustainabilityMetrics(w)
+	if res != nil && res.Report == nil && err != nil {
+		// errors of the packages are usually the cause
+		for _, d := range res.Diagnostics {
+			fmt.Fprintln(os.Stderr, d)
+		}
 	}
-	g.WriteProjectURL(w)
-	if _, err := w.Write(formatted); err != nil {
-		log.Fatalf("write stdout: %v", err)
+	dst := destination{path: *outPath, report: *reportPath, diff: os.Stdout}
+	return reportOf(res), writeBundle(res, err, dst)
+}
+
+func reportOf(res *bundler.Result) *bundler.Report {
+	if res == nil {
+		return nil
 	}
+	return res.Report
+}
+
+// destination tells writeBundle where to write a bundle.
+type destination struct {
+	path   string    // output file; stdout or the clipboard when empty
+	report string    // JSON report file, if any
+	diff   io.Writer // receives the diff of -check
 }
 
-func loadPackages(dir string) ([]*packages.Package, error) {
-	absDir, err := filepath.Abs(dir)
+// writeBundle writes the report of res and, unless err is set by bundling,
+// its source to dst. It returns err or the first write error.
+func writeBundle(res *bundler.Result, err error, dst destination) error {
+	report := reportOf(res)
+	if report != nil && dst.report != "" && !*check {
+		if werr := report.WriteFile(dst.report); werr != nil && err == nil {
+			err = fmt.Errorf("write report: %w", werr)
+		}
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to get abs path of %s", dir)
+		return err
 	}
+	out := res.Source
 
-	cfg := &packages.Config{
-		Mode: packages.NeedName |
-			packages.NeedFiles |
-			packages.NeedSyntax |
-			packages.NeedTypes |
-			packages.NeedTypesInfo |
-			packages.NeedDeps |
-			packages.NeedModule |
-			packages.NeedCompiledGoFiles |
-			packages.NeedImports,
-		Dir:   absDir,
-		Tests: false,
+	// output formatted file
+	switch {
+	case *check:
+		if err := checkBundle(dst.path, out, dst.diff); err != nil {
+			return err
+		}
+	case dst.path != "":
+		if err := atomicfile.Write(dst.path, out); err != nil {
+			return fmt.Errorf("write %s: %w", dst.path, err)
+		}
+	case *clipboard || *clipboardCmd != "":
+		// copied below instead of writing to stdout
+	default:
+		if _, err := os.Stdout.Write(out); err != nil {
+			return fmt.Errorf("write stdout: %w", err)
+		}
 	}
 
-	pkgs, err := packages.Load(cfg, ".")
-	if err != nil {
-		return nil, fmt.Errorf("failed to load package: %w", err)
+	if (*clipboard || *clipboardCmd != "") && !*check {
+		if err := copyToClipboard(out, *clipboardCmd); err != nil {
+			return fmt.Errorf("clipboard: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "copied %d bytes to the clipboard\n", len(out))
 	}
+	return nil
+}
 
-	return pkgs, nil
+// applyProfile fills in settings from the selected profile that were not set explicitly.
+func applyProfile() error {
+	if *profile == "" {
+		return nil
+	}
+	p, err := lookupProfile(*profile)
+	if err != nil {
+		return err
+	}
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if !set["max-size"] {
+		maxSize = sizeFlag(p.MaxSize)
+	}
+	return nil
 }
@@ -0,0 +1,564 @@
+package main
+
+import (
+	"encoding/json"
+	"io/fs"
+	"maps"
+	"math/rand/v2"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Atnuhs/go-bundler/bundler"
+	"github.com/Atnuhs/go-bundler/internal/atomicfile"
+	"github.com/Atnuhs/go-bundler/internal/cachedir"
+)
+
+func assertContains(t *testing.T, output, substr string) {
+	t.Helper()
+	if !strings.Contains(output, substr) {
+		t.Errorf("expected %q in output\ngot:\n%s", substr, output)
+	}
+}
+
+func assertNotContains(t *testing.T, output, substr string) {
+	t.Helper()
+	if strings.Contains(output, substr) {
+		t.Errorf("unexpected %q in output\ngot:\n%s", substr, output)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{in: "65536", want: 65536},
+		{in: "64KiB", want: 64 << 10},
+		{in: "64KB", want: 64 << 10},
+		{in: "512k", want: 512 << 10},
+		{in: "1MiB", want: 1 << 20},
+		{in: "100B", want: 100},
+	}
+	for _, tt := range tests {
+		got, err := parseSize(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("parseSize(%q) = %d, %v; want %d", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{"big", "9999999999999M"} {
+		if _, err := parseSize(in); err == nil {
+			t.Errorf("parseSize(%q) should fail", in)
+		}
+	}
+}
+
+func TestExtract(t *testing.T) {
+	extract := func(dir, target, prefix string) string {
+		t.Helper()
+		res, err := extractSnippet(dir, target, prefix)
+		if err != nil {
+			t.Fatalf("extractSnippet(%q) error = %v", target, err)
+		}
+		return string(res.Source)
+	}
+	got := extract("bundler/testdata/src/library", "./mathx.Median", "")
+	assertNotContains(t, got, "package ")
+	assertContains(t, got, "import \"sort\"")
+	assertContains(t, got, "func Median(a []int) int {")
+	assertNotContains(t, got, "Min")
+
+	got = extract("bundler/testdata/src/library", "github.com/Atnuhs/go-bundler/bundler/testdata/src/library.UnionFind", "uf_")
+	assertContains(t, got, "func (u *uf_UnionFind) Union(x, y int) {")
+	assertContains(t, got, "func mathx_Min(a, b int) int {")
+	assertNotContains(t, got, "NewUnionFind")
+	assertNotContains(t, got, "func main()")
+
+	// the import path has a dot in its last element
+	got = extract("bundler/testdata/src/roots", "./yaml.v3.Node.Decode", "")
+	assertContains(t, got, "func (Node) Decode() {")
+	assertNotContains(t, got, "Unused")
+
+	// errors in code the snippet does not need are reported, not fatal
+	mod := t.TempDir()
+	for name, src := range map[string]string{
+		"go.mod": "module example.com/warn\n\ngo 1.22\n",
+		"lib.go": "package warn\n\nfunc Used() int { return 1 }\n\nfunc Broken() int { return undefined }\n",
+	} {
+		if err := os.WriteFile(filepath.Join(mod, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	res, err := extractSnippet(mod, "example.com/warn.Used", "")
+	if err != nil {
+		t.Fatalf("extractSnippet() with an unrelated error: %v", err)
+	}
+	assertContains(t, string(res.Source), "func Used() int")
+	if len(res.Diagnostics) != 1 {
+		t.Errorf("diagnostics = %v, want the error of Broken", res.Diagnostics)
+	}
+
+	for _, target := range []string{"github.com/x/pkg", "./missing.F"} {
+		if _, err := extractSnippet("bundler/testdata/src/roots", target, ""); err == nil {
+			t.Errorf("extractSnippet(%q) should fail", target)
+		}
+	}
+}
+
+func TestCheckBundle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bundled.go")
+	if err := os.WriteFile(path, []byte("a\nb\nc\nd\ne\nf\ng\nh\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf strings.Builder
+	if err := checkBundle(path, []byte("a\nb\nc\nd\ne\nf\ng\nh\n"), &buf); err != nil || buf.Len() != 0 {
+		t.Errorf("checkBundle() up to date: err = %v, diff = %q", err, buf.String())
+	}
+
+	err := checkBundle(path, []byte("a\nB\nc\nd\ne\nf\ng\nH\n"), &buf)
+	if err == nil {
+		t.Fatal("checkBundle() should fail when the file is out of date")
+	}
+	assertContains(t, err.Error(), "is out of date")
+	want := "--- " + path + "\n+++ " + path + " (bundled)\n" +
+		"@@ -1,8 +1,8 @@\n a\n-b\n+B\n c\n d\n e\n f\n g\n-h\n+H\n"
+	if buf.String() != want {
+		t.Errorf("diff =\n%s\nwant\n%s", buf.String(), want)
+	}
+	got, _ := os.ReadFile(path)
+	if string(got) != "a\nb\nc\nd\ne\nf\ng\nh\n" {
+		t.Error("checkBundle() must not write the file")
+	}
+
+	buf.Reset()
+	if err := checkBundle(path, []byte("a\nb\nc\nd\ne\nf\ng\nh"), &buf); err == nil {
+		t.Fatal("checkBundle() should fail when only the final newline differs")
+	}
+	want = "--- " + path + "\n+++ " + path + " (bundled)\n" +
+		"@@ -5,4 +5,4 @@\n e\n f\n g\n-h\n+h\n\\ No newline at end of file\n"
+	if buf.String() != want {
+		t.Errorf("diff =\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	lines := func() []string {
+		s := make([]string, r.IntN(30))
+		for i := range s {
+			s[i] = string(rune('a' + r.IntN(4)))
+		}
+		return s
+	}
+	for range 500 {
+		a, b := lines(), lines()
+		ops := diffLines(a, b)
+
+		// the script turns a into b
+		var gotA, gotB []string
+		edits := 0
+		for _, op := range ops {
+			switch op.kind {
+			case ' ':
+				if a[op.a] != b[op.b] {
+					t.Fatalf("diffLines(%q, %q) keeps different lines", a, b)
+				}
+				gotA, gotB = append(gotA, a[op.a]), append(gotB, b[op.b])
+			case '-':
+				gotA = append(gotA, a[op.a])
+				edits++
+			case '+':
+				gotB = append(gotB, b[op.b])
+				edits++
+			}
+		}
+		if !slices.Equal(gotA, a) || !slices.Equal(gotB, b) {
+			t.Fatalf("diffLines(%q, %q) = %v does not cover both inputs", a, b, ops)
+		}
+		// and is the shortest one
+		lcs := make([][]int, len(a)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(b)+1)
+		}
+		for i := len(a) - 1; i >= 0; i-- {
+			for j := len(b) - 1; j >= 0; j-- {
+				if a[i] == b[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else {
+					lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+				}
+			}
+		}
+		if want := len(a) + len(b) - 2*lcs[0][0]; edits != want {
+			t.Fatalf("diffLines(%q, %q) has %d edits, want %d", a, b, edits, want)
+		}
+	}
+}
+
+func TestCopyToClipboard(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the command uses sh quoting")
+	}
+	path := filepath.Join(t.TempDir(), "clip board")
+	if err := copyToClipboard([]byte("bundle"), "cat > '"+path+"'"); err != nil {
+		t.Fatalf("copyToClipboard() error = %v", err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "bundle" {
+		t.Errorf("clipboard command got %q, want %q", got, "bundle")
+	}
+	if err := copyToClipboard(nil, "exit 3"); err == nil {
+		t.Error("copyToClipboard() should fail when the command fails")
+	}
+}
+
+func TestOSC52(t *testing.T) {
+	if got := string(osc52([]byte("hi"), false)); got != "\x1b]52;c;aGk=\a" {
+		t.Errorf("osc52() = %q", got)
+	}
+	if got := string(osc52([]byte("hi"), true)); got != "\x1bPtmux;\x1b\x1b]52;c;aGk=\a\x1b\\" {
+		t.Errorf("osc52() in tmux = %q", got)
+	}
+}
+
+func TestWatchFiles(t *testing.T) {
+	dir := t.TempDir()
+	main := filepath.Join(dir, "main.go")
+	if err := os.WriteFile(main, []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	files := watchFiles(dir, nil, nil)
+	if len(files) != 1 || files[0] != main {
+		t.Fatalf("watchFiles() = %v, want [%s]", files, main)
+	}
+	prev := stamps(files)
+	if cur := stamps(files); !maps.Equal(prev, cur) {
+		t.Errorf("stamps changed without an edit: %v, %v", prev, cur)
+	}
+
+	if err := os.WriteFile(main, []byte("package main\n\nfunc main() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if cur := stamps(files); maps.Equal(prev, cur) {
+		t.Error("stamps did not change after an edit")
+	}
+	prev = stamps(files)
+
+	// an output written next to the sources, e.g. by -o or -report
+	if err := atomicfile.Write(filepath.Join(dir, "out.txt"), []byte("bundle")); err != nil {
+		t.Fatal(err)
+	}
+	if cur := stamps(files); !maps.Equal(prev, cur) {
+		t.Errorf("stamps changed after writing a non-Go file: %v, %v", prev, cur)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "sub.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if cur := stamps(files); maps.Equal(prev, cur) {
+		t.Error("stamps did not change after adding a file")
+	}
+	if len(watchFiles(dir, nil, files)) != 2 {
+		t.Error("watchFiles() misses an added file")
+	}
+}
+
+func TestBatch(t *testing.T) {
+	out := t.TempDir()
+	defer func(d, o string) { *dir, *outPath = d, o }(*dir, *outPath)
+	*dir = "bundler/testdata/src"
+	*outPath = filepath.Join(out, "{{.Dir}}", "main.go")
+
+	var summary strings.Builder
+	if err := runBatch(bundler.Options{Dir: *dir}, []string{"./no-deps", "./single-deps", "./library"}, 2, &summary); err != nil {
+		t.Fatalf("runBatch() error = %v\n%s", err, summary.String())
+	}
+	for _, name := range []string{"no-deps", "single-deps"} {
+		got, err := os.ReadFile(filepath.Join(out, name, "main.go"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertContains(t, string(got), "func main()")
+		assertContains(t, summary.String(), name)
+	}
+	// not a main package
+	assertNotContains(t, summary.String(), "library")
+}
+
+func TestServe(t *testing.T) {
+	dir, err := os.MkdirTemp("bundler/testdata/src", "serve-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	dir, _ = filepath.Abs(dir)
+	write := func(name, src string) {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	libPath := "github.com/Atnuhs/go-bundler/bundler/testdata/src/" + filepath.Base(dir) + "/lib"
+	write("main.go", "package main\n\nimport (\n\t\"fmt\"\n\n\t\""+libPath+"\"\n)\n\nfunc main() {\n\tfmt.Println(lib.Greeting())\n}\n")
+	write("lib/lib.go", "package lib\n\nfunc Greeting() string { return \"hello\" + suffix }\n")
+	// files are selected by the build tags of GOFLAGS after a reload too
+	t.Setenv("GOFLAGS", strings.TrimSpace(os.Getenv("GOFLAGS")+" -tags=serve"))
+	write("lib/tagged.go", "//go:build serve\n\npackage lib\n\nconst suffix = \"!\"\n")
+	write("lib/untagged.go", "//go:build !serve\n\npackage lib\n\nconst suffix = \"?\"\n")
+
+	s := newServer()
+	bundle := func() string {
+		t.Helper()
+		resp := s.handle(serveRequest{Dir: dir})
+		if resp.Error != "" {
+			t.Fatalf("handle() error = %s", resp.Error)
+		}
+		return resp.Bundle
+	}
+	assertContains(t, bundle(), `"hello" + lib_suffix`)
+	assertContains(t, bundle(), `"!"`)
+	fmtPkg := s.loaded[dir].pkgs[0].Imports["fmt"]
+
+	write("lib/lib.go", "package lib\n\nfunc Greeting() string { return \"bonjour\" + suffix }\n")
+	got := bundle()
+	assertContains(t, got, `"bonjour"`)
+	assertContains(t, got, `"!"`)
+	if s.loaded[dir].pkgs[0].Imports["fmt"] != fmtPkg {
+		t.Error("std packages were loaded again after editing a local package")
+	}
+
+	// files parsed again do not fill the file set for ever
+	s.loaded[dir].loadedBase = 1
+	write("lib/lib.go", "package lib\n\nfunc Greeting() string { return \"salut\" + suffix }\n")
+	assertContains(t, bundle(), `"salut"`)
+	if s.loaded[dir].pkgs[0].Imports["fmt"] == fmtPkg {
+		t.Error("packages were not loaded again after the file set outgrew the first load")
+	}
+
+	// a new file in a package and a new use of it
+	write("lib/extra.go", "package lib\n\nfunc Extra() string { return \"extra\" }\n")
+	write("main.go", "package main\n\nimport (\n\t\"fmt\"\n\n\t\""+libPath+"\"\n)\n\nfunc main() {\n\tfmt.Println(lib.Greeting(), lib.Extra())\n}\n")
+	got = bundle()
+	assertContains(t, got, `"extra"`)
+
+	want, err := bundler.Run(bundler.Options{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want.Source) {
+		t.Errorf("refreshed bundle differs from a fresh load\nrefreshed:\n%s\nfresh:\n%s", got, want.Source)
+	}
+
+	ln, err := net.Listen("unix", filepath.Join(t.TempDir(), "s.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go s.serve(ln)
+	res, err := requestBundle(ln.Addr().String(), serveRequest{Dir: dir})
+	if err != nil {
+		t.Fatalf("requestBundle() error = %v", err)
+	}
+	if string(res.Source) != got || res.Report == nil {
+		t.Errorf("requestBundle() = %q, report %v; want the served bundle", res.Source, res.Report)
+	}
+}
+
+func TestOutputCache(t *testing.T) {
+	t.Setenv(cachedir.Env, t.TempDir())
+	dir, err := os.MkdirTemp("bundler/testdata/src", "cache-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	write := func(name, src string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("main.go", "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(greeting)\n}\n")
+	write("greeting.go", "package main\n\nconst greeting = \"hello\"\n")
+
+	cached := func() (string, bool) {
+		t.Helper()
+		res, err := runCached(bundler.Options{Dir: dir})
+		if err != nil {
+			t.Fatalf("runCached() error = %v", err)
+		}
+		return string(res.Source), len(res.Report.Timings) == 1 && res.Report.Timings[0].Phase == "cache"
+	}
+	out, hit := cached()
+	if hit {
+		t.Fatal("first bundle came from the cache")
+	}
+	if again, hit := cached(); !hit || again != out {
+		t.Errorf("second bundle: hit = %v, same output = %v", hit, again == out)
+	}
+
+	write("greeting.go", "package main\n\nconst greeting = \"bonjour\"\n")
+	out, hit = cached()
+	if hit {
+		t.Error("bundle came from the cache after an edit")
+	}
+	assertContains(t, out, `"bonjour"`)
+
+	// a new file in the package changes the input set
+	write("extra.go", "package main\n")
+	if _, hit := cached(); hit {
+		t.Error("bundle came from the cache after adding a file")
+	}
+	if _, hit := cached(); !hit {
+		t.Fatal("bundle did not come from the cache")
+	}
+	// cgo selects files by build constraint
+	t.Setenv("CGO_ENABLED", "0")
+	if _, hit := cached(); hit {
+		t.Error("bundle came from the cache after switching cgo")
+	}
+
+	var list strings.Builder
+	if err := runCache([]string{"list"}, &list); err != nil {
+		t.Fatal(err)
+	}
+	assertContains(t, list.String(), "fresh")
+	var clean strings.Builder
+	if err := runCache([]string{"clean"}, &clean); err != nil {
+		t.Fatal(err)
+	}
+	assertContains(t, clean.String(), "removed 2 of 2")
+}
+
+func TestOverlay(t *testing.T) {
+	tmp := t.TempDir()
+	replacement := filepath.Join(tmp, "main.go")
+	if err := os.WriteFile(replacement, []byte("package main\n\nfunc main() {\n\tprintln(unsaved())\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	overlayPath := filepath.Join(tmp, "overlay.json")
+	data, err := json.Marshal(map[string]any{"Replace": map[string]string{"bundler/testdata/src/no-deps/main.go": replacement}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(overlayPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// a file that only exists in the editor
+	stdin := strings.NewReader("package main\n\nfunc unsaved() string { return \"from stdin\" }\n")
+	overlay, err := readOverlay(overlayPath, "bundler/testdata/src/no-deps/unsaved.go", stdin)
+	if err != nil {
+		t.Fatalf("readOverlay() error = %v", err)
+	}
+	res, err := bundler.Run(bundler.Options{Dir: "bundler/testdata/src/no-deps", Overlay: overlay})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	output := string(res.Source)
+	assertContains(t, output, "println(main_unsaved())")
+	assertContains(t, output, `"from stdin"`)
+	assertNotContains(t, output, "inner")
+
+	if _, err := readOverlay("", "", nil); err != nil {
+		t.Errorf("readOverlay() without inputs error = %v", err)
+	}
+}
+
+func TestRev(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	for _, kv := range [][2]string{
+		{"GIT_AUTHOR_NAME", "test"}, {"GIT_AUTHOR_EMAIL", "test@example.com"},
+		{"GIT_COMMITTER_NAME", "test"}, {"GIT_COMMITTER_EMAIL", "test@example.com"},
+		{"GIT_CONFIG_GLOBAL", os.DevNull}, {"GIT_CONFIG_NOSYSTEM", "1"},
+		// workspaces reject -mod=mod
+		{"GOFLAGS", ""},
+	} {
+		t.Setenv(kv[0], kv[1])
+	}
+	repo := t.TempDir()
+	write := func(name, src string) {
+		t.Helper()
+		path := filepath.Join(repo, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gitRun := func(args ...string) {
+		t.Helper()
+		if _, err := git(repo, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the team library is a separate module, replaced with a relative path
+	write("tools/go.mod", "module example.com/tools\n\ngo 1.22\n\nrequire example.com/lib v0.0.0\n\nreplace example.com/lib => ../lib\n")
+	write("tools/cmd/a/main.go", "package main\n\nimport \"example.com/lib\"\n\nfunc main() {\n\tprintln(lib.Version())\n}\n")
+	write("lib/go.mod", "module example.com/lib\n\ngo 1.22\n")
+	write("lib/lib.go", "package lib\n\nfunc Version() string { return \"v1\" }\n")
+	write("other/big.txt", "not read\n")
+	gitRun("init", "-q")
+	gitRun("add", "-A")
+	gitRun("commit", "-q", "-m", "v1")
+	gitRun("tag", "v1")
+
+	write("lib/lib.go", "package lib\n\nfunc Version() string { return \"v\" + minor }\n")
+	write("lib/minor.go", "package lib\n\nconst minor = \"2\"\n")
+
+	bundle := func(dir string) string {
+		t.Helper()
+		fsys, sub, err := revFS(filepath.Join(repo, dir), "v1")
+		if err != nil {
+			t.Fatalf("revFS() error = %v", err)
+		}
+		if sub != dir {
+			t.Errorf("revFS() dir = %q, want %s", sub, dir)
+		}
+		if _, err := fs.Stat(fsys, "other/big.txt"); err == nil {
+			t.Error("revFS() read a file outside the modules")
+		}
+		res, err := bundler.Run(bundler.Options{FS: fsys, Dir: sub})
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		return string(res.Source)
+	}
+	output := bundle("tools/cmd/a")
+	assertContains(t, output, `return "v1"`)
+	assertNotContains(t, output, "minor")
+	// the working tree is left alone
+	if data, _ := os.ReadFile(filepath.Join(repo, "lib/minor.go")); len(data) == 0 {
+		t.Error("working tree changed")
+	}
+
+	// a workspace instead of the replacement
+	write("go.work", "go 1.22\n\nuse (\n\t./tools\n\t./lib\n)\n")
+	write("tools/go.mod", "module example.com/tools\n\ngo 1.22\n")
+	gitRun("add", "-A")
+	gitRun("commit", "-q", "-m", "v2")
+	gitRun("tag", "-f", "v1")
+	write("lib/lib.go", "package lib\n\nfunc Version() string { return \"v3\" }\n")
+	assertContains(t, bundle("tools/cmd/a"), `return "v" + lib_minor`)
+
+	write("tools/go.mod", "module example.com/tools\n\ngo 1.22\n\nreplace example.com/lib => ../../lib\n")
+	gitRun("add", "-A")
+	gitRun("commit", "-q", "-m", "outside")
+	if _, _, err := revFS(filepath.Join(repo, "tools"), "HEAD"); err == nil || !strings.Contains(err.Error(), "outside the repository") {
+		t.Errorf("revFS() with a replacement outside the repository error = %v", err)
+	}
+	if _, _, err := revFS(repo, "no-such-rev"); err == nil {
+		t.Error("revFS() should fail for an unknown revision")
+	}
+}
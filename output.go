@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// copyToClipboard copies data by piping it to command when one is given, or
+// else with an OSC 52 escape sequence written to the controlling terminal.
+// command is run by the shell, so it may quote its arguments.
+func copyToClipboard(data []byte, command string) error {
+	if command != "" {
+		cmd := exec.Command("sh", "-c", command)
+		if runtime.GOOS == "windows" {
+			cmd = exec.Command("cmd", "/c", command)
+		}
+		cmd.Stdin = bytes.NewReader(data)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%s: %v: %s", command, err, strings.TrimSpace(stderr.String()))
+		}
+		return nil
+	}
+
+	tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0)
+	if err != nil {
+		return errors.New("no terminal for OSC 52; use -clipboard-cmd")
+	}
+	defer tty.Close()
+	_, err = tty.Write(osc52(data, os.Getenv("TMUX") != ""))
+	return err
+}
+
+// osc52 returns the escape sequence that sets the clipboard to data. Inside
+// tmux the sequence is wrapped in a passthrough so it reaches the outer terminal.
+func osc52(data []byte, tmux bool) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("\x1b]52;c;")
+	enc := base64.NewEncoder(base64.StdEncoding, &buf)
+	enc.Write(data)
+	enc.Close()
+	buf.WriteString("\a")
+	if !tmux {
+		return buf.Bytes()
+	}
+
+	var wrapped bytes.Buffer
+	wrapped.WriteString("\x1bPtmux;")
+	wrapped.Write(bytes.ReplaceAll(buf.Bytes(), []byte("\x1b"), []byte("\x1b\x1b")))
+	wrapped.WriteString("\x1b\\")
+	return wrapped.Bytes()
+}
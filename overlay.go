@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// overlayFile is the format of the -overlay file of go build.
+type overlayFile struct {
+	Replace map[string]string
+}
+
+// readOverlay returns the contents replacing files on disk: the files named
+// by the overlay file at path and, when stdinFile is set, stdin as the
+// contents of stdinFile. It returns nil when both are empty.
+func readOverlay(path, stdinFile string, stdin io.Reader) (map[string][]byte, error) {
+	if path == "" && stdinFile == "" {
+		return nil, nil
+	}
+	overlay := make(map[string][]byte)
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var f overlayFile
+		if err := json.Unmarshal(data, &f); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		for file, replacement := range f.Replace {
+			if replacement == "" {
+				return nil, fmt.Errorf("%s: deleting %s is not supported", path, file)
+			}
+			src, err := os.ReadFile(replacement)
+			if err != nil {
+				return nil, err
+			}
+			abs, err := filepath.Abs(file)
+			if err != nil {
+				return nil, err
+			}
+			overlay[abs] = src
+		}
+	}
+	if stdinFile != "" {
+		src, err := io.ReadAll(stdin)
+		if err != nil {
+			return nil, fmt.Errorf("read stdin: %w", err)
+		}
+		abs, err := filepath.Abs(stdinFile)
+		if err != nil {
+			return nil, err
+		}
+		overlay[abs] = src
+	}
+	return overlay, nil
+}
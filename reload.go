@@ -0,0 +1,287 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"go/version"
+	"maps"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Atnuhs/go-bundler/bundler"
+	"golang.org/x/tools/go/packages"
+)
+
+// loadedPackages is a package graph kept by the server, with the stamps of
+// the files it was loaded from and the responses computed from it.
+type loadedPackages struct {
+	pkgs      []*packages.Package
+	stamps    map[string]map[string]fileStamp // by package path
+	responses map[string]serveResponse        // by encoded request
+
+	// build selects the files of a package when it is parsed again, as the
+	// go command did for the first load.
+	build build.Context
+	// loadedBase is the base of the file set after the first load. Files
+	// parsed again are added to the shared file set, so the graph is loaded
+	// again once they take as much space as the first load did.
+	loadedBase int
+}
+
+func loadGraph(dir string) (*loadedPackages, error) {
+	ctx, err := buildContext(dir)
+	if err != nil {
+		return nil, err
+	}
+	pkgs, err := bundler.Load(bundler.Options{Dir: dir})
+	if err != nil {
+		return nil, err
+	}
+	lp := newLoadedPackages(pkgs, ctx)
+	if fset := lp.fset(); fset != nil {
+		lp.loadedBase = fset.Base()
+	}
+	return lp, nil
+}
+
+// buildContext returns the build context of the go command in dir: its
+// target, cgo setting, Go version and the build tags of GOFLAGS.
+func buildContext(dir string) (build.Context, error) {
+	data, err := goEnvJSON(dir)
+	if err != nil {
+		return build.Context{}, err
+	}
+	var env struct {
+		GOROOT, GOVERSION, GOOS, GOARCH, GOFLAGS, CGO_ENABLED string
+	}
+	if err := json.Unmarshal(data, &env); err != nil {
+		return build.Context{}, fmt.Errorf("go env: %w", err)
+	}
+	ctx := build.Default
+	ctx.GOROOT, ctx.GOOS, ctx.GOARCH = env.GOROOT, env.GOOS, env.GOARCH
+	ctx.CgoEnabled = env.CGO_ENABLED == "1"
+	for _, flag := range strings.Fields(env.GOFLAGS) {
+		if tags, ok := strings.CutPrefix(strings.TrimLeft(flag, "-"), "tags="); ok {
+			ctx.BuildTags = strings.Split(tags, ",")
+		}
+	}
+	// go1.N is satisfied by every release from go1.1 to the one in use
+	if minor, err := strconv.Atoi(strings.TrimPrefix(version.Lang(env.GOVERSION), "go1.")); err == nil {
+		ctx.ReleaseTags = nil
+		for i := 1; i <= minor; i++ {
+			ctx.ReleaseTags = append(ctx.ReleaseTags, "go1."+strconv.Itoa(i))
+		}
+	}
+	return ctx, nil
+}
+
+func newLoadedPackages(pkgs []*packages.Package, ctx build.Context) *loadedPackages {
+	lp := &loadedPackages{
+		pkgs:      pkgs,
+		stamps:    make(map[string]map[string]fileStamp),
+		responses: make(map[string]serveResponse),
+		build:     ctx,
+	}
+	for _, pkg := range localPackages(pkgs) {
+		lp.stamps[pkg.PkgPath] = stamps(pkg.CompiledGoFiles)
+	}
+	return lp
+}
+
+// localPackages returns the packages of the graph loaded from source, which
+// are the non-std ones, dependencies first.
+func localPackages(pkgs []*packages.Package) []*packages.Package {
+	var ret []*packages.Package
+	packages.Visit(pkgs, nil, func(p *packages.Package) {
+		if len(p.Syntax) > 0 {
+			ret = append(ret, p)
+		}
+	})
+	return ret
+}
+
+// fset returns the file set shared by the packages of the graph.
+func (lp *loadedPackages) fset() *token.FileSet {
+	for _, pkg := range lp.pkgs {
+		if pkg.Fset != nil {
+			return pkg.Fset
+		}
+	}
+	return nil
+}
+
+// changed returns the packages with a file that was modified, added or removed.
+func (lp *loadedPackages) changed() []*packages.Package {
+	var ret []*packages.Package
+	for _, pkg := range localPackages(lp.pkgs) {
+		if !maps.Equal(lp.stamps[pkg.PkgPath], stamps(pkg.CompiledGoFiles)) {
+			ret = append(ret, pkg)
+		}
+	}
+	return ret
+}
+
+// refresh returns a new graph in which the changed packages are parsed again
+// and they and the packages importing them are type-checked again. Other
+// packages, std included, are shared with lp. It fails when the graph itself
+// changed, e.g. a package imports one that was not loaded, or when the
+// files parsed again outgrow the first load, in which case it must be loaded
+// again.
+func (lp *loadedPackages) refresh(changed []*packages.Package) (*loadedPackages, error) {
+	if fset := lp.fset(); fset != nil && fset.Base()-lp.loadedBase > lp.loadedBase {
+		return nil, errors.New("files parsed again outgrew the first load")
+	}
+	dirty := make(map[*packages.Package]bool, len(changed))
+	for _, pkg := range changed {
+		dirty[pkg] = true
+	}
+	updated := make(map[*packages.Package]*packages.Package)
+	for _, pkg := range localPackages(lp.pkgs) {
+		stale := dirty[pkg]
+		for _, imp := range pkg.Imports {
+			if _, ok := updated[imp]; ok {
+				stale = true
+			}
+		}
+		if !stale {
+			continue
+		}
+		p, err := recheck(pkg, dirty[pkg], updated, &lp.build)
+		if err != nil {
+			return nil, err
+		}
+		updated[pkg] = p
+	}
+
+	pkgs := make([]*packages.Package, len(lp.pkgs))
+	for i, pkg := range lp.pkgs {
+		pkgs[i] = pkg
+		if p, ok := updated[pkg]; ok {
+			pkgs[i] = p
+		}
+	}
+	next := newLoadedPackages(pkgs, lp.build)
+	next.loadedBase = lp.loadedBase
+	return next, nil
+}
+
+// recheck returns a copy of pkg type-checked against the updated imports.
+// When reparse is set, the files of its directory are listed and parsed again.
+func recheck(pkg *packages.Package, reparse bool, updated map[*packages.Package]*packages.Package, ctx *build.Context) (*packages.Package, error) {
+	p := *pkg
+	p.Errors, p.TypeErrors = nil, nil
+	for _, e := range pkg.Errors {
+		if e.Kind == packages.ParseError && !reparse {
+			p.Errors = append(p.Errors, e)
+		}
+	}
+	if reparse {
+		files, err := packageFiles(ctx, pkg)
+		if err != nil {
+			return nil, err
+		}
+		p.GoFiles, p.CompiledGoFiles = files, files
+		p.Syntax = p.Syntax[:0:0]
+		for _, file := range files {
+			f, err := parser.ParseFile(pkg.Fset, file, nil, parser.AllErrors|parser.ParseComments)
+			var list scanner.ErrorList
+			if errors.As(err, &list) {
+				for _, e := range list {
+					p.Errors = append(p.Errors, packages.Error{Pos: e.Pos.String(), Msg: e.Msg, Kind: packages.ParseError})
+				}
+			} else if err != nil {
+				return nil, err
+			}
+			if f != nil {
+				p.Syntax = append(p.Syntax, f)
+			}
+		}
+		if len(p.Syntax) > 0 {
+			p.Name = p.Syntax[0].Name.Name
+		}
+	}
+
+	p.Imports = make(map[string]*packages.Package, len(pkg.Imports))
+	for _, f := range p.Syntax {
+		for _, spec := range f.Imports {
+			path, err := strconv.Unquote(spec.Path.Value)
+			if err != nil {
+				continue
+			}
+			imp, ok := pkg.Imports[path]
+			if !ok {
+				return nil, fmt.Errorf("%s now imports %s", pkg.PkgPath, path)
+			}
+			if u, ok := updated[imp]; ok {
+				imp = u
+			}
+			p.Imports[path] = imp
+		}
+	}
+
+	p.Types = types.NewPackage(pkg.PkgPath, p.Name)
+	p.TypesInfo = &types.Info{
+		Types:        make(map[ast.Expr]types.TypeAndValue),
+		Defs:         make(map[*ast.Ident]types.Object),
+		Uses:         make(map[*ast.Ident]types.Object),
+		Implicits:    make(map[ast.Node]types.Object),
+		Instances:    make(map[*ast.Ident]types.Instance),
+		Scopes:       make(map[ast.Node]*types.Scope),
+		Selections:   make(map[*ast.SelectorExpr]*types.Selection),
+		FileVersions: make(map[*ast.File]string),
+	}
+	conf := &types.Config{
+		Importer: importerFunc(func(path string) (*types.Package, error) {
+			if path == "unsafe" {
+				return types.Unsafe, nil
+			}
+			if imp, ok := p.Imports[path]; ok && imp.Types != nil {
+				return imp.Types, nil
+			}
+			return nil, fmt.Errorf("no metadata for %s", path)
+		}),
+		Sizes: pkg.TypesSizes,
+		Error: func(err error) {
+			if te, ok := err.(types.Error); ok {
+				p.TypeErrors = append(p.TypeErrors, te)
+				p.Errors = append(p.Errors, packages.Error{Pos: te.Fset.Position(te.Pos).String(), Msg: te.Msg, Kind: packages.TypeError})
+			}
+		},
+	}
+	if pkg.Module != nil && pkg.Module.GoVersion != "" {
+		conf.GoVersion = "go" + pkg.Module.GoVersion
+	}
+	types.NewChecker(conf, pkg.Fset, p.Types, p.TypesInfo).Files(p.Syntax)
+	p.IllTyped = len(p.Errors) > 0
+	return &p, nil
+}
+
+// packageFiles lists the Go files of the directory of pkg that match the
+// build constraints of ctx.
+func packageFiles(ctx *build.Context, pkg *packages.Package) ([]string, error) {
+	dir := filepath.Dir(pkg.CompiledGoFiles[0])
+	bp, err := ctx.ImportDir(dir, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(bp.CgoFiles) > 0 {
+		return nil, fmt.Errorf("%s uses cgo", pkg.PkgPath)
+	}
+	files := make([]string, len(bp.GoFiles))
+	for i, name := range bp.GoFiles {
+		files[i] = filepath.Join(dir, name)
+	}
+	return files, nil
+}
+
+type importerFunc func(path string) (*types.Package, error)
+
+func (f importerFunc) Import(path string) (*types.Package, error) { return f(path) }
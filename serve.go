@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Atnuhs/go-bundler/bundler"
+)
+
+// serveRequest is a request of the serve protocol: one JSON object per line
+// naming the package directory and the settings of the bundle. The fields
+// mirror the command line flags of the same names; omitted fields take
+// their defaults.
+type serveRequest struct {
+	Dir                       string            `json:"dir"`
+	DCE                       bool              `json:"dce,omitempty"`
+	Defines                   map[string]string `json:"defines,omitempty"`
+	StripCalls                []string          `json:"strip_calls,omitempty"`
+	PruneFields               bool              `json:"prune_fields,omitempty"`
+	PrefixStrategy            string            `json:"prefix_strategy,omitempty"`
+	Order                     string            `json:"order,omitempty"`
+	Shake                     string            `json:"shake,omitempty"`
+	Library                   bool              `json:"lib,omitempty"`
+	PackageName               string            `json:"pkg_name,omitempty"`
+	Roots                     []string          `json:"roots,omitempty"`
+	Minify                    bool              `json:"minify,omitempty"`
+	WithMetrics               bool              `json:"with_metrics,omitempty"`
+	WithSustainabilityMetrics bool              `json:"with_sustainability_metrics,omitempty"`
+	MaxSize                   int64             `json:"max_size,omitempty"`
+}
+
+// serveResponse answers a serveRequest on one line. Error is set when
+// bundling failed; Report is set whenever the packages were bundled.
+type serveResponse struct {
+	Bundle      string               `json:"bundle,omitempty"`
+	Report      *bundler.Report      `json:"report,omitempty"`
+	Diagnostics []bundler.Diagnostic `json:"diagnostics,omitempty"`
+	Error       string               `json:"error,omitempty"`
+}
+
+func newServeRequest(opts bundler.Options) serveRequest {
+	dir := opts.Dir
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	return serveRequest{
+		Dir:                       dir,
+		DCE:                       opts.EliminateDeadCode,
+		Defines:                   opts.Defines,
+		StripCalls:                opts.StripCalls,
+		PruneFields:               opts.PruneFields,
+		PrefixStrategy:            string(opts.PrefixStrategy),
+		Order:                     string(opts.Order),
+		Shake:                     string(opts.Shake),
+		Library:                   opts.Library,
+		PackageName:               opts.PackageName,
+		Roots:                     opts.Roots,
+		Minify:                    opts.Minify,
+		WithMetrics:               opts.WithMetrics,
+		WithSustainabilityMetrics: opts.WithSustainabilityMetrics,
+		MaxSize:                   opts.MaxSize,
+	}
+}
+
+func (r serveRequest) options() (bundler.Options, error) {
+	order := bundler.OrderKind
+	if r.Order != "" {
+		var err error
+		if order, err = bundler.ParseOrder(r.Order); err != nil {
+			return bundler.Options{}, err
+		}
+	}
+	prefix := bundler.PrefixName
+	if r.PrefixStrategy != "" {
+		var err error
+		if prefix, err = bundler.ParsePrefixStrategy(r.PrefixStrategy); err != nil {
+			return bundler.Options{}, err
+		}
+	}
+	shake := bundler.ShakeRTA
+	if r.Shake != "" {
+		var err error
+		if shake, err = bundler.ParseShake(r.Shake); err != nil {
+			return bundler.Options{}, err
+		}
+	}
+	return bundler.Options{
+		Dir:                       r.Dir,
+		EliminateDeadCode:         r.DCE,
+		Defines:                   r.Defines,
+		StripCalls:                r.StripCalls,
+		PruneFields:               r.PruneFields,
+		PrefixStrategy:            prefix,
+		Order:                     order,
+		Shake:                     shake,
+		Library:                   r.Library || r.PackageName != "",
+		PackageName:               r.PackageName,
+		Roots:                     r.Roots,
+		Minify:                    r.Minify,
+		WithMetrics:               r.WithMetrics,
+		WithSustainabilityMetrics: r.WithSustainabilityMetrics,
+		MaxSize:                   r.MaxSize,
+	}, nil
+}
+
+// defaultSocket returns the socket path used when serve has no -socket.
+func defaultSocket() string {
+	return filepath.Join(os.TempDir(), fmt.Sprintf("go-bundler-%d.sock", os.Getuid()))
+}
+
+// runServe implements "go-bundler serve". It keeps loaded packages in
+// memory and answers bundle requests on a Unix socket until interrupted.
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	path := fs.String("socket", defaultSocket(), "listen on the Unix socket at `path`")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: go-bundler serve [flags]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if conn, err := net.Dial("unix", *path); err == nil {
+		conn.Close()
+		return fmt.Errorf("a server is already listening on %s", *path)
+	}
+	// left behind by a server that did not exit cleanly
+	os.Remove(*path)
+	ln, err := net.Listen("unix", *path)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	log.Printf("listening on %s", *path)
+	newServer().serve(ln)
+	return nil
+}
+
+// server answers bundle requests from packages loaded once per directory.
+type server struct {
+	mu     sync.Mutex
+	loaded map[string]*loadedPackages // by absolute directory
+}
+
+func newServer() *server {
+	return &server{loaded: make(map[string]*loadedPackages)}
+}
+
+// serve accepts connections until ln is closed.
+func (s *server) serve(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Print(err)
+			}
+			return
+		}
+		go s.serveConn(conn)
+	}
+}
+
+func (s *server) serveConn(conn net.Conn) {
+	defer conn.Close()
+	sc := bufio.NewScanner(conn)
+	sc.Buffer(nil, 1<<20)
+	enc := json.NewEncoder(conn)
+	for sc.Scan() {
+		var req serveRequest
+		resp := serveResponse{}
+		if err := json.Unmarshal(sc.Bytes(), &req); err != nil {
+			resp.Error = fmt.Sprintf("invalid request: %v", err)
+		} else {
+			resp = s.handle(req)
+		}
+		if err := enc.Encode(resp); err != nil {
+			return
+		}
+	}
+}
+
+// handle answers req, reusing the loaded packages of req.Dir and the
+// response to an identical request while no source file has changed.
+func (s *server) handle(req serveRequest) serveResponse {
+	start := time.Now()
+	if !filepath.IsAbs(req.Dir) {
+		return serveResponse{Error: fmt.Sprintf("dir must be an absolute path, got %q", req.Dir)}
+	}
+	opts, err := req.options()
+	if err != nil {
+		return serveResponse{Error: err.Error()}
+	}
+	key, _ := json.Marshal(req)
+
+	s.mu.Lock()
+	lp, err := s.packages(req.Dir)
+	if err != nil {
+		s.mu.Unlock()
+		return serveResponse{Error: fmt.Sprintf("load packages: %v", err)}
+	}
+	if resp, ok := lp.responses[string(key)]; ok {
+		s.mu.Unlock()
+		log.Printf("%s: unchanged", req.Dir)
+		return resp
+	}
+	s.mu.Unlock()
+
+	res, err := bundler.Bundle(lp.pkgs, opts)
+	resp := serveResponse{Bundle: string(res.Source), Report: res.Report, Diagnostics: res.Diagnostics}
+	if err != nil {
+		resp.Error = err.Error()
+		log.Printf("%s: %v", req.Dir, err)
+	} else {
+		log.Printf("%s: bundled %d bytes in %v", req.Dir, len(res.Source), time.Since(start).Round(time.Millisecond))
+	}
+
+	s.mu.Lock()
+	lp.responses[string(key)] = resp
+	s.mu.Unlock()
+	return resp
+}
+
+// packages returns the packages of dir, loading them on first use and
+// refreshing the changed ones afterwards. s.mu must be held.
+func (s *server) packages(dir string) (*loadedPackages, error) {
+	lp, ok := s.loaded[dir]
+	if !ok {
+		lp, err := loadGraph(dir)
+		if err != nil {
+			return nil, err
+		}
+		s.loaded[dir] = lp
+		return lp, nil
+	}
+	changed := lp.changed()
+	if len(changed) == 0 {
+		return lp, nil
+	}
+	next, err := lp.refresh(changed)
+	if err != nil {
+		log.Printf("%s: %v; loading again", dir, err)
+		if next, err = loadGraph(dir); err != nil {
+			delete(s.loaded, dir)
+			return nil, err
+		}
+	}
+	s.loaded[dir] = next
+	return next, nil
+}
+
+// requestBundle sends req to the server listening on socket and returns
+// its answer like bundler.Run does.
+func requestBundle(socket string, req serveRequest) (*bundler.Result, error) {
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("connect to server: %w", err)
+	}
+	defer conn.Close()
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+	var resp serveResponse
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	res := &bundler.Result{Report: resp.Report, Diagnostics: resp.Diagnostics}
+	if resp.Error != "" {
+		return res, errors.New(resp.Error)
+	}
+	res.Source = []byte(resp.Bundle)
+	return res, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Profile holds settings for a specific online judge.
+type Profile struct {
+	MaxSize int64
+}
+
+var profiles = map[string]Profile{
+	"atcoder":    {MaxSize: 512 << 10},
+	"codeforces": {MaxSize: 64 << 10},
+}
+
+func lookupProfile(name string) (Profile, error) {
+	p, ok := profiles[name]
+	if !ok {
+		names := make([]string, 0, len(profiles))
+		for n := range profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return Profile{}, fmt.Errorf("unknown profile %q (available: %s)", name, strings.Join(names, ", "))
+	}
+	return p, nil
+}
+
+// sizeFlag is a byte size flag accepting plain bytes or a K, KB, KiB, M, MB or MiB suffix.
+// All suffixes are binary: 64KB and 64KiB are both 65536 bytes.
+type sizeFlag int64
+
+func (s *sizeFlag) String() string {
+	return strconv.FormatInt(int64(*s), 10)
+}
+
+func (s *sizeFlag) Set(v string) error {
+	n, err := parseSize(v)
+	if err != nil {
+		return err
+	}
+	*s = sizeFlag(n)
+	return nil
+}
+
+func parseSize(v string) (int64, error) {
+	units := []struct {
+		suffix string
+		scale  int64
+	}{
+		{"KiB", 1 << 10}, {"KB", 1 << 10}, {"K", 1 << 10},
+		{"MiB", 1 << 20}, {"MB", 1 << 20}, {"M", 1 << 20},
+		{"B", 1},
+	}
+	s := strings.TrimSpace(v)
+	scale := int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(strings.ToUpper(s), strings.ToUpper(u.suffix)) {
+			s = strings.TrimSpace(s[:len(s)-len(u.suffix)])
+			scale = u.scale
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", v)
+	}
+	if n > math.MaxInt64/scale {
+		return 0, fmt.Errorf("size %q is too large", v)
+	}
+	return n * scale, nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Atnuhs/go-bundler/bundler"
+)
+
+// watchInterval is how often watched files are polled.
+const watchInterval = 300 * time.Millisecond
+
+// fileStamp identifies a version of a file, or the Go files of a directory.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+	names   string // Go files of a directory, NUL-separated
+}
+
+// watchAndRun calls bundle, then polls the source files of the last
+// successful bundle and calls it again whenever one of them changes.
+// Errors are logged and never stop watching. The outputs bundle writes are
+// not watched, so that writing them does not trigger another run.
+func watchAndRun(dir string, interval time.Duration, outputs []string, bundle func() (*bundler.Report, error)) {
+	ignore := make(map[string]bool)
+	for _, path := range outputs {
+		if abs, err := filepath.Abs(path); err == nil && path != "" {
+			ignore[abs] = true
+		}
+	}
+	files := watchFiles(dir, nil, nil)
+	for {
+		prev := stamps(files)
+		start := time.Now()
+		report, err := bundle()
+		files = slices.DeleteFunc(watchFiles(dir, report, files), func(f string) bool { return ignore[f] })
+		cur := stamps(files)
+		for path, stamp := range cur {
+			if _, ok := prev[path]; !ok {
+				prev[path] = stamp
+			}
+		}
+		// an output written into a package directory is not an added file
+		for path := range ignore {
+			if s, ok := cur[filepath.Dir(path)]; ok {
+				prev[filepath.Dir(path)] = s
+			}
+		}
+		if report != nil {
+			for _, w := range report.Warnings {
+				log.Print(w)
+			}
+		}
+		if err != nil {
+			log.Print(err)
+		} else {
+			log.Printf("bundled %d bytes in %v; watching %d files", report.BundledBytes, time.Since(start).Round(time.Millisecond), len(files))
+		}
+
+		for {
+			time.Sleep(interval)
+			if cur := stamps(files); !maps.Equal(prev, cur) {
+				break
+			}
+		}
+	}
+}
+
+// watchFiles returns the files to watch: the compiled Go files of every
+// bundled package and all Go files in their directories, so that files which
+// do not compile yet are watched too. Without a report, the directories of
+// the previously watched files and dir are used.
+func watchFiles(dir string, report *bundler.Report, prev []string) []string {
+	set := make(map[string]bool)
+	dirs := make(map[string]bool)
+	if abs, err := filepath.Abs(dir); err == nil {
+		dirs[abs] = true
+	}
+	if report != nil {
+		for _, p := range report.Packages {
+			for _, f := range p.Files {
+				set[f] = true
+				dirs[filepath.Dir(f)] = true
+			}
+		}
+	} else {
+		for _, f := range prev {
+			dirs[filepath.Dir(f)] = true
+		}
+	}
+	for d := range dirs {
+		matches, _ := filepath.Glob(filepath.Join(d, "*.go"))
+		for _, f := range matches {
+			set[f] = true
+		}
+	}
+	return slices.Sorted(maps.Keys(set))
+}
+
+// stamps returns the stamp of each file and the Go files of each directory
+// holding one, so that added and removed files are noticed as well. Other
+// changes to a directory, such as a written output, are not. Missing files
+// get a zero stamp.
+func stamps(files []string) map[string]fileStamp {
+	ret := make(map[string]fileStamp, len(files)*2)
+	for _, f := range files {
+		var s fileStamp
+		if fi, err := os.Stat(f); err == nil {
+			s = fileStamp{modTime: fi.ModTime(), size: fi.Size()}
+		}
+		ret[f] = s
+		if d := filepath.Dir(f); ret[d] == (fileStamp{}) {
+			matches, _ := filepath.Glob(filepath.Join(d, "*.go"))
+			for i, m := range matches {
+				matches[i] = filepath.Base(m)
+			}
+			ret[d] = fileStamp{names: strings.Join(matches, "\x00")}
+		}
+	}
+	return ret
+}